@@ -0,0 +1,197 @@
+package bot
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/logging"
+)
+
+type Config struct {
+	// Version is the schema version of the config, see CurrentConfigVersion.
+	Version int    `json:"version,omitempty"`
+	Chats   []Chat `json:"chats"`
+	// Groups are named sets of chats tagged like aliases.
+	Groups       []Group  `json:"groups,omitempty"`
+	HelpContacts []string `json:"help_contacts"`
+	// TagPrefixes start tags, like "*" in *Galway or "#" in #Galway. Only
+	// DefaultTagPrefix does if there are none.
+	TagPrefixes []string `json:"tag_prefixes,omitempty"`
+	// TreeCommand enables the /tree command, which posts the chat tree.
+	TreeCommand bool          `json:"tree_command,omitempty"`
+	Logging     LoggingConfig `json:"logging,omitempty"`
+	// MembershipValidation is used by the membership validation daemon.
+	MembershipValidation *MembershipValidation `json:"membership_validation,omitempty"`
+}
+
+type MembershipValidation struct {
+	Notification Notification `json:"notification"`
+}
+
+// Notification lists where the daemon reports membership problems.
+type Notification struct {
+	TgChats []NotificationTgChat `json:"tg_chats"`
+}
+
+type NotificationTgChat struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type LoggingConfig struct {
+	// Level is one of "debug", "info", "warn" or "error", "info" by default.
+	Level string `json:"level,omitempty"`
+	// VerbosePayloads logs message texts and whole Bot API payloads instead
+	// of redacting them. It's meant to be turned on temporarily for debugging.
+	VerbosePayloads bool `json:"verbose_payloads,omitempty"`
+	// VerboseUntil turns VerbosePayloads off automatically after that time.
+	VerboseUntil *time.Time `json:"verbose_until,omitempty"`
+}
+
+// NewLogger creates a stderr logger with the configured level. A non-empty
+// level overrides the configured one, e.g. when it comes from a flag.
+func (lc LoggingConfig) NewLogger(level string) (*logging.Logger, error) {
+	if level == "" {
+		level = lc.Level
+	}
+	l, err := logging.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	return logging.New(os.Stderr, l), nil
+}
+
+// Verbose reports whether payloads may be logged as they are at the moment now.
+func (lc LoggingConfig) Verbose(now time.Time) bool {
+	if !lc.VerbosePayloads {
+		return false
+	}
+	return lc.VerboseUntil == nil || now.Before(*lc.VerboseUntil)
+}
+
+type Chat struct {
+	ID int64 `json:"id"`
+	// Title names the chat in diagrams and the chat tree.
+	Title string `json:"title,omitempty"`
+	// Description tells users what the chat is about in inline suggestions.
+	Description string  `json:"description,omitempty"`
+	Aliases     []Alias `json:"aliases"`
+	// AcceptFrom lists the chats allowed to forward messages here by their IDs
+	// or aliases. Every chat of the config may if it's empty.
+	AcceptFrom []string `json:"accept_from,omitempty"`
+	ChildChats []Chat   `json:"child_chats,omitempty"`
+	// TagPrefixes are the prefixes of Config.TagPrefixes tags in the chat
+	// may start with. All of them may if it's empty.
+	TagPrefixes []string `json:"tag_prefixes,omitempty"`
+	// SilenceUnknownTags stops the bot from suggesting aliases when a tag in
+	// the chat matches none.
+	SilenceUnknownTags bool `json:"silence_unknown_tags,omitempty"`
+	// MembersMustBeInAnyChildChat makes the membership validation daemon
+	// report members of the chat who aren't in any of its child chats.
+	MembersMustBeInAnyChildChat bool `json:"members_must_be_in_any_child_chat,omitempty"`
+}
+
+// Alias is a name chats are tagged by, with optional metadata. In the config
+// it's either the name alone or an object.
+type Alias struct {
+	Name string `json:"name"`
+	// Description tells users what the tag is for in /help and inline
+	// suggestions.
+	Description string `json:"description,omitempty"`
+	// DeprecatedBy names the alias to use instead. A deprecated alias still
+	// tags its chats, but the bot asks the sender to use the new one.
+	DeprecatedBy string `json:"deprecated_by,omitempty"`
+	// Hidden aliases tag their chats but aren't suggested.
+	Hidden bool `json:"hidden,omitempty"`
+}
+
+// NewAliases returns aliases with the given names and no metadata.
+func NewAliases(names ...string) []Alias {
+	aliases := make([]Alias, len(names))
+	for i, name := range names {
+		aliases[i] = Alias{Name: name}
+	}
+	return aliases
+}
+
+// plainAlias is Alias without its JSON methods.
+type plainAlias Alias
+
+func (a *Alias) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*a = Alias{}
+		return json.Unmarshal(data, &a.Name)
+	}
+	return json.Unmarshal(data, (*plainAlias)(a))
+}
+
+// MarshalJSON writes aliases without metadata as bare names.
+func (a Alias) MarshalJSON() ([]byte, error) {
+	if a == (Alias{Name: a.Name}) {
+		return json.Marshal(a.Name)
+	}
+	return json.Marshal(plainAlias(a))
+}
+
+// Suggested reports whether users should be offered the alias.
+func (a Alias) Suggested() bool {
+	return !a.Hidden && a.DeprecatedBy == ""
+}
+
+// AliasNames returns the names of the aliases of the chat.
+func (chat Chat) AliasNames() []string {
+	names := make([]string, len(chat.Aliases))
+	for i, alias := range chat.Aliases {
+		names[i] = alias.Name
+	}
+	return names
+}
+
+// Prefixes returns the prefixes tags may start with.
+func (config Config) Prefixes() []string {
+	if len(config.TagPrefixes) == 0 {
+		return []string{DefaultTagPrefix}
+	}
+	return config.TagPrefixes
+}
+
+func (config Config) AllAliases() []string {
+	aliases := make(map[string]bool)
+	queue := config.Chats
+	for len(queue) > 0 {
+		chat := queue[0]
+		queue = queue[1:]
+
+		for _, alias := range chat.Aliases {
+			aliases[alias.Name] = true
+		}
+		queue = append(queue, chat.ChildChats...)
+	}
+	for _, g := range config.Groups {
+		aliases[g.Name] = true
+	}
+	var aliasesList []string
+	for alias := range aliases {
+		aliasesList = append(aliasesList, alias)
+	}
+	sort.Slice(aliasesList, func(i, j int) bool {
+		return strings.ToLower(aliasesList[i]) < strings.ToLower(aliasesList[j])
+	})
+	return aliasesList
+}
+
+func (config Config) AllChats() []Chat {
+	var allChats []Chat
+	queue := config.Chats
+	for len(queue) > 0 {
+		chat := queue[0]
+		queue = queue[1:]
+
+		allChats = append(allChats, chat)
+		queue = append(queue, chat.ChildChats...)
+	}
+	return allChats
+}
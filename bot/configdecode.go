@@ -0,0 +1,428 @@
+package bot
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Position is a place in a config file. Both the line and the column start at 1.
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// Problem is a single issue found in a config.
+type Problem struct {
+	// Path points to the offending value, e.g. "chats[0].aliases[1]". It's
+	// empty for problems with the whole document.
+	Path    string
+	Pos     Position
+	Message string
+	// Warning problems don't stop the config from being used.
+	Warning bool
+}
+
+func (p Problem) String() string {
+	var b strings.Builder
+	if p.Pos.IsValid() {
+		fmt.Fprintf(&b, "%d:%d: ", p.Pos.Line, p.Pos.Column)
+	}
+	if p.Warning {
+		b.WriteString("warning: ")
+	}
+	if p.Path != "" {
+		b.WriteString(p.Path + ": ")
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+type Problems []Problem
+
+// Err returns a *ConfigError with all the errors, or nil if there are only
+// warnings.
+func (ps Problems) Err() error {
+	var errs Problems
+	for _, p := range ps {
+		if !p.Warning {
+			errs = append(errs, p)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ConfigError{Problems: errs}
+}
+
+// Warnings returns the problems that don't stop the config from being used.
+func (ps Problems) Warnings() Problems {
+	var warnings Problems
+	for _, p := range ps {
+		if p.Warning {
+			warnings = append(warnings, p)
+		}
+	}
+	return warnings
+}
+
+// ConfigError reports every error found in a config at once.
+type ConfigError struct {
+	Problems Problems
+}
+
+func (e *ConfigError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.String()
+	}
+	if len(lines) == 1 {
+		return "invalid config: " + lines[0]
+	}
+	return fmt.Sprintf("invalid config, %d problems:\n%s", len(lines), strings.Join(lines, "\n"))
+}
+
+// ParseConfig strictly decodes a JSON config and validates it. Unknown fields
+// and values of wrong types are errors, as well as the problems reported by
+// Config.Validate. The config is only usable if problems.Err() is nil.
+func ParseConfig(data []byte) (Config, Problems) {
+	return ParseConfigAs(data, FormatJSON)
+}
+
+// ParseConfigAs is ParseConfig for a config of the given format.
+func ParseConfigAs(data []byte, format Format) (Config, Problems) {
+	doc, positions, problems := decodeDocument(data, format)
+	if problems != nil {
+		return Config{}, problems
+	}
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return Config{}, Problems{typeProblem("", "an object", doc)}
+	}
+
+	from, err := migrateDocument(obj)
+	if err != nil {
+		return Config{}, positions.locate(Problems{{Path: "version", Message: err.Error()}})
+	}
+	if from < CurrentConfigVersion {
+		problems = append(problems, Problem{Path: "version", Warning: true, Message: fmt.Sprintf(
+			"config version %d is older than %d and was upgraded in memory, run \"retg migrate-config\" to upgrade the file",
+			from, CurrentConfigVersion)})
+	}
+
+	// The document is decoded once more into the Config, from JSON whatever
+	// its format was. Problems are still located in the original document,
+	// falling back to parent paths for fields the migrations moved.
+	data, err = json.Marshal(obj)
+	if err != nil {
+		return Config{}, Problems{{Message: err.Error()}}
+	}
+	problems = append(problems, checkSchema(reflect.TypeOf(Config{}), obj, "")...)
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		// Values of wrong types are already reported with their paths.
+		if problems.Err() == nil {
+			problems = append(problems, Problem{Message: err.Error()})
+		}
+		return Config{}, positions.locate(problems)
+	}
+	problems = append(problems, config.Validate()...)
+	return config, positions.locate(problems)
+}
+
+// positions maps paths of a document to where their values, or keys of
+// object members, start.
+type positions map[string]Position
+
+// locate fills in the positions of problems and orders them as they appear
+// in the document.
+func (ps positions) locate(problems Problems) Problems {
+	for i := range problems {
+		if problems[i].Pos.IsValid() {
+			continue
+		}
+		for path := problems[i].Path; ; path = parentPath(path) {
+			if pos, ok := ps[path]; ok {
+				problems[i].Pos = pos
+				break
+			}
+			if path == "" {
+				break
+			}
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i].Pos, problems[j].Pos
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return problems
+}
+
+func parentPath(path string) string {
+	i := strings.LastIndexAny(path, ".[")
+	if i < 0 {
+		return ""
+	}
+	return path[:i]
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func indexPath(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+// jsonPositions walks the tokens of data and records the position of every
+// value in it.
+func jsonPositions(data []byte) (positions, error) {
+	w := positionWalker{
+		data:      data,
+		dec:       json.NewDecoder(bytes.NewReader(data)),
+		positions: make(positions),
+	}
+	if err := w.value(""); err != nil {
+		return nil, err
+	}
+	if w.dec.More() {
+		return nil, &json.SyntaxError{Offset: int64(w.offset())}
+	}
+	return w.positions, nil
+}
+
+type positionWalker struct {
+	data      []byte
+	dec       *json.Decoder
+	positions positions
+}
+
+// offset returns where the next token starts.
+func (w *positionWalker) offset() int {
+	off := int(w.dec.InputOffset())
+	for off < len(w.data) && strings.IndexByte(" \t\r\n,:", w.data[off]) >= 0 {
+		off++
+	}
+	return off
+}
+
+func (w *positionWalker) value(path string) error {
+	if _, ok := w.positions[path]; !ok {
+		w.positions[path] = offsetPosition(w.data, w.offset())
+	}
+	tok, err := w.dec.Token()
+	if err != nil {
+		return err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return nil
+	}
+	switch delim {
+	case '{':
+		for w.dec.More() {
+			keyOffset := w.offset()
+			tok, err := w.dec.Token()
+			if err != nil {
+				return err
+			}
+			key, _ := tok.(string)
+			child := joinPath(path, key)
+			w.positions[child] = offsetPosition(w.data, keyOffset)
+			if err := w.value(child); err != nil {
+				return err
+			}
+		}
+	case '[':
+		for i := 0; w.dec.More(); i++ {
+			if err := w.value(indexPath(path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = w.dec.Token()
+	return err
+}
+
+func offsetPosition(data []byte, offset int) Position {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	lineStart := bytes.LastIndexByte(before, '\n') + 1
+	return Position{Line: line, Column: utf8.RuneCount(before[lineStart:]) + 1}
+}
+
+func syntaxProblem(data []byte, err error) Problem {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		msg := syntaxErr.Error()
+		if msg == "" {
+			msg = "unexpected data after the config"
+		}
+		return Problem{Pos: offsetPosition(data, int(syntaxErr.Offset)), Message: msg}
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return Problem{Path: typeErr.Field, Pos: offsetPosition(data, int(typeErr.Offset)), Message: err.Error()}
+	}
+	if errors.Is(err, io.EOF) {
+		return Problem{Message: "the config is empty"}
+	}
+	return Problem{Message: err.Error()}
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	aliasType           = reflect.TypeOf(Alias{})
+)
+
+// checkSchema compares a generic document against the Go type it's decoded
+// into and reports unknown fields and values of wrong types.
+func checkSchema(t reflect.Type, v interface{}, path string) Problems {
+	if v == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == aliasType {
+		// An alias is a name or an object checked like any other.
+		if _, ok := v.(string); ok {
+			return nil
+		}
+		if _, ok := v.(map[string]interface{}); !ok {
+			return Problems{typeProblem(path, "a string or an object", v)}
+		}
+	} else if reflect.PtrTo(t).Implements(jsonUnmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return nil
+	}
+
+	var problems Problems
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return Problems{typeProblem(path, "an object", v)}
+		}
+		fields := jsonFields(t)
+		for key, value := range obj {
+			field, ok := fields[key]
+			if !ok {
+				problems = append(problems, Problem{Path: joinPath(path, key), Message: unknownFieldMessage(key, fields)})
+				continue
+			}
+			problems = append(problems, checkSchema(field.Type, value, joinPath(path, key))...)
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return Problems{typeProblem(path, "an object", v)}
+		}
+		for key, value := range obj {
+			problems = append(problems, checkSchema(t.Elem(), value, joinPath(path, key))...)
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return Problems{typeProblem(path, "an array", v)}
+		}
+		for i, value := range arr {
+			problems = append(problems, checkSchema(t.Elem(), value, indexPath(path, i))...)
+		}
+	case reflect.String:
+		if _, ok := v.(string); !ok {
+			return Problems{typeProblem(path, "a string", v)}
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			return Problems{typeProblem(path, "true or false", v)}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := v.(json.Number)
+		if !ok {
+			return Problems{typeProblem(path, "an integer", v)}
+		}
+		if _, err := n.Int64(); err != nil {
+			return Problems{typeProblem(path, "an integer", v)}
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := v.(json.Number); !ok {
+			return Problems{typeProblem(path, "a number", v)}
+		}
+	}
+	return problems
+}
+
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+func unknownFieldMessage(key string, fields map[string]reflect.StructField) string {
+	best, bestDistance := "", 3
+	for name := range fields {
+		if d := editDistance(key, name); d < bestDistance || d == bestDistance && name < best {
+			best, bestDistance = name, d
+		}
+	}
+	if best == "" {
+		return fmt.Sprintf("unknown field %q", key)
+	}
+	return fmt.Sprintf("unknown field %q, did you mean %q?", key, best)
+}
+
+func typeProblem(path, want string, got interface{}) Problem {
+	return Problem{Path: path, Message: fmt.Sprintf("expected %s, got %s", want, describeJSON(got))}
+}
+
+func describeJSON(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return fmt.Sprintf("the string %q", v)
+	case json.Number:
+		return "the number " + v.String()
+	case bool:
+		return fmt.Sprintf("%v", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
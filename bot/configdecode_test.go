@@ -0,0 +1,232 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseConfigReportsAllProblems(t *testing.T) {
+	data := `{"version": 2,
+  "chats": [
+    {
+      "id": 1,
+      "alias": ["First"],
+      "child_chats": [
+        {"id": 1, "aliases": ["Sec", "Second", "*Third", "Fourth Chat", ""]},
+        {"id": "12", "aliases": ["Twelfth"]}
+      ]
+    }
+  ],
+  "help_contacts": []
+}`
+
+	_, problems := ParseConfig([]byte(data))
+
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	want := []string{
+		`5:7: chats[0].alias: unknown field "alias", did you mean "aliases"?`,
+		`8:10: chats[0].child_chats[1].id: expected an integer, got the string "12"`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Wrong schema problems, cmp.Diff(want, got):\n%s", diff)
+	}
+	if problems.Err() == nil {
+		t.Errorf("Schema problems have to make the config unusable")
+	}
+}
+
+func TestParseConfigValidatesSemantics(t *testing.T) {
+	data := `{"version": 2,
+  "chats": [
+    {
+      "id": 1,
+      "aliases": ["First"],
+      "child_chats": [
+        {"id": 1, "aliases": ["Sec", "Second", "*Third", "Fourth  Chat", ""]},
+        {"id": 12, "aliases": ["Twelfth", "Elfth"]}
+      ]
+    }
+  ],
+  "help_contacts": []
+}`
+
+	_, problems := ParseConfig([]byte(data))
+
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	want := []string{
+		`7:10: chats[0].child_chats[0].id: chat ID 1 is already used by chats[0]`,
+		`7:38: chats[0].child_chats[0].aliases[1]: alias "Second" starts with alias "Sec", so *Second also tags *Sec`,
+		`7:48: chats[0].child_chats[0].aliases[2]: alias "*Third" contains "*"`,
+		`7:58: chats[0].child_chats[0].aliases[3]: alias "Fourth  Chat" may only have single spaces between words`,
+		`7:74: chats[0].child_chats[0].aliases[4]: empty alias`,
+		`8:32: warning: chats[0].child_chats[1].aliases[0]: alias "Twelfth" contains alias "Elfth"`,
+		`12:3: help_contacts: no help contacts, /help would name nobody to ask`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Wrong problems, cmp.Diff(want, got):\n%s", diff)
+	}
+	if err := problems.Err(); err == nil || strings.Contains(err.Error(), "Twelfth") {
+		t.Errorf("Err() = %v, want the errors without the warning", err)
+	}
+}
+
+func TestParseConfigSyntaxError(t *testing.T) {
+	_, problems := ParseConfig([]byte("{\n  \"chats\": [],\n}"))
+
+	if len(problems) != 1 || problems[0].Pos != (Position{Line: 2, Column: 15}) {
+		t.Errorf("Expected a single syntax error at 2:15, got %v", problems)
+	}
+}
+
+func TestParseConfigAcceptsValidConfig(t *testing.T) {
+	data := `{"version": 2,
+  "chats": [{"id": 1, "aliases": ["First"], "members_must_be_in_any_child_chat": true,
+             "child_chats": [{"id": 10, "aliases": ["Tenth"]}]}],
+  "help_contacts": ["@Karas"],
+  "membership_validation": {"notification": {"tg_chats": [{"id": 5, "name": "Admins"}]}}
+}`
+
+	config, problems := ParseConfig([]byte(data))
+
+	if len(problems) != 0 {
+		t.Fatalf("Unexpected problems: %v", problems)
+	}
+	if got := len(config.AllChats()); got != 2 {
+		t.Errorf("Expected 2 chats, got %d", got)
+	}
+}
+
+func TestParseConfigChecksACLs(t *testing.T) {
+	data := `{"version": 2,
+  "chats": [{"id": 1, "aliases": ["First"]},
+            {"id": 2, "aliases": ["Second"], "accept_from": ["1", "*first", "Third", "3"]}],
+  "help_contacts": ["@Karas"]
+}`
+
+	_, problems := ParseConfig([]byte(data))
+
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	want := []string{
+		`3:77: chats[1].accept_from[2]: no chat with ID or alias "Third"`,
+		`3:86: chats[1].accept_from[3]: no chat with ID or alias "3"`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Wrong problems, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestParseConfigChecksAliasMetadata(t *testing.T) {
+	data := `{"version": 2,
+  "chats": [{"id": 1, "aliases": [{"name": "First", "description": "The first chat"}, "Uno"]},
+            {"id": 2, "aliases": [{"name": "Second", "deprecated_by": "First", "hiden": true},
+                                  {"name": "Deux", "deprecated_by": "Deux"}, 2]},
+            {"id": 3, "aliases": [{"name": "Third", "deprecated_by": "Fourth"},
+                                  {"name": "Trois", "deprecated_by": "Second"}]}],
+  "help_contacts": ["@Karas"]
+}`
+
+	_, problems := ParseConfig([]byte(data))
+
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	want := []string{
+		`3:80: chats[1].aliases[0].hiden: unknown field "hiden", did you mean "hidden"?`,
+		`4:78: chats[1].aliases[2]: expected a string or an object, got the number 2`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Wrong schema problems, cmp.Diff(want, got):\n%s", diff)
+	}
+
+	data = strings.NewReplacer(`, "hiden": true`, "", `, 2]`, "]").Replace(data)
+	config, problems := ParseConfig([]byte(data))
+
+	got = nil
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	want = []string{
+		`4:52: chats[1].aliases[1].deprecated_by: alias "Deux" is deprecated by itself`,
+		`5:53: chats[2].aliases[0].deprecated_by: alias "Third" is deprecated by "Fourth", which is no alias`,
+		`6:53: chats[2].aliases[1].deprecated_by: alias "Trois" is deprecated by "Second", which is deprecated by "First" too`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Wrong problems, cmp.Diff(want, got):\n%s", diff)
+	}
+	wantAliases := []Alias{{Name: "First", Description: "The first chat"}, {Name: "Uno"}}
+	if diff := cmp.Diff(wantAliases, config.Chats[0].Aliases); diff != "" {
+		t.Errorf("Wrong aliases decoded, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestParseConfigChecksGroups(t *testing.T) {
+	data := `{"version": 2,
+  "chats": [{"id": 1, "aliases": ["First"], "child_chats": [{"id": 10, "aliases": ["Tenth"]}]}],
+  "groups": [
+    {"name": "Tree", "subtrees": [1, 2]},
+    {"name": "Ring", "union": ["Tree", "Loop"]},
+    {"name": "Loop", "union": ["Ring"], "difference": ["Nobody"]},
+    {"name": "first", "chats": [1]},
+    {"name": "Nothing", "difference": ["Tree"]},
+    {"name": "Tree", "chats": [10]}
+  ],
+  "help_contacts": ["@Karas"]
+}`
+
+	_, problems := ParseConfig([]byte(data))
+
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	want := []string{
+		`4:38: groups[0].subtrees[1]: no chat with ID 2`,
+		`5:5: groups[1]: group "Ring" depends on itself: Ring → Loop → Ring`,
+		`6:5: groups[2]: group "Loop" depends on itself: Loop → Ring → Loop`,
+		`6:56: groups[2].difference[0]: no group "Nobody"`,
+		`7:6: groups[3].name: group "first" is named like the alias at chats[0].aliases[0]`,
+		`8:5: warning: groups[4]: group "Nothing" has no chats`,
+		`9:6: groups[5].name: group "Tree" is already defined by groups[0]`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Wrong problems, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestParseConfigChecksTagPrefixes(t *testing.T) {
+	data := `{"version": 2,
+  "tag_prefixes": ["*", "#", "", "t", "#"],
+  "chats": [{"id": 1, "aliases": ["First"], "tag_prefixes": ["#", "!"]},
+            {"id": 2, "aliases": ["Second"], "tag_prefixes": []}],
+  "help_contacts": ["@Karas"]
+}`
+
+	_, problems := ParseConfig([]byte(data))
+
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	want := []string{
+		`2:30: tag_prefixes[2]: empty tag prefix`,
+		`2:34: tag_prefixes[3]: tag prefix "t" may only have symbols and punctuation other than quotes, "_" and "-"`,
+		`2:39: tag_prefixes[4]: tag prefix "#" is listed twice`,
+		`3:67: chats[0].tag_prefixes[1]: tag prefix "!" isn't one of the config's tag_prefixes`,
+		`4:46: chats[1].tag_prefixes: no tag prefixes, leave tag_prefixes out to allow all`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Wrong problems, cmp.Diff(want, got):\n%s", diff)
+	}
+}
@@ -0,0 +1,364 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a syntax the config can be written in. All formats describe the
+// same document: the field names, semantics and validation are those of the
+// JSON config.
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+	FormatTOML Format = "toml"
+)
+
+// FormatOf returns the format of a config file by its extension, JSON if the
+// extension is unknown.
+func FormatOf(name string) Format {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatJSON
+	}
+}
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case FormatJSON, FormatYAML, FormatTOML:
+		return f, nil
+	case "yml":
+		return FormatYAML, nil
+	}
+	return "", fmt.Errorf("unknown config format %q, expected json, yaml or toml", name)
+}
+
+// DecodeDocument decodes a config of the given format into a generic
+// document made of map[string]interface{}, []interface{}, string,
+// json.Number, bool and nil, as a JSON decoder with UseNumber would.
+func DecodeDocument(data []byte, format Format) (interface{}, error) {
+	doc, _, problems := decodeDocument(data, format)
+	if err := problems.Err(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// ConvertConfig rewrites a config in another format. It keeps the document as
+// it is, unknown fields included, but not the comments.
+func ConvertConfig(data []byte, from, to Format) ([]byte, error) {
+	doc, err := DecodeDocument(data, from)
+	if err != nil {
+		return nil, err
+	}
+	return encodeDocument(doc, to)
+}
+
+func decodeDocument(data []byte, format Format) (interface{}, positions, Problems) {
+	switch format {
+	case FormatYAML:
+		return decodeYAML(data)
+	case FormatTOML:
+		return decodeTOML(data)
+	default:
+		return decodeJSON(data)
+	}
+}
+
+func encodeDocument(doc interface{}, format Format) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case FormatYAML:
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(yamlNode(reflect.TypeOf(Config{}), doc)); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+	case FormatTOML:
+		enc := toml.NewEncoder(&buf)
+		enc.Indent = ""
+		if err := enc.Encode(tomlValue(reflect.TypeOf(Config{}), doc)); err != nil {
+			return nil, err
+		}
+	default:
+		writeOrdered(&buf, reflect.TypeOf(Config{}), doc, "")
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeJSON(data []byte) (interface{}, positions, Problems) {
+	positions, err := jsonPositions(data)
+	if err != nil {
+		return nil, nil, Problems{syntaxProblem(data, err)}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, nil, Problems{syntaxProblem(data, err)}
+	}
+	return doc, positions, nil
+}
+
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): `)
+
+func decodeYAML(data []byte) (interface{}, positions, Problems) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		msg := err.Error()
+		var pos Position
+		if m := yamlErrorLine.FindStringSubmatch(msg); m != nil {
+			pos.Line, _ = strconv.Atoi(m[1])
+			msg = strings.TrimPrefix(msg, m[0])
+		}
+		return nil, nil, Problems{{Pos: pos, Message: msg}}
+	}
+	if len(root.Content) == 0 {
+		return nil, nil, Problems{{Message: "the config is empty"}}
+	}
+	d := yamlDecoder{positions: make(positions)}
+	doc := d.value(root.Content[0], "")
+	if len(d.problems) > 0 {
+		return nil, nil, d.positions.locate(d.problems)
+	}
+	return doc, d.positions, nil
+}
+
+type yamlDecoder struct {
+	positions positions
+	problems  Problems
+}
+
+func (d *yamlDecoder) value(n *yaml.Node, path string) interface{} {
+	if _, ok := d.positions[path]; !ok {
+		d.positions[path] = Position{Line: n.Line, Column: n.Column}
+	}
+	switch n.Kind {
+	case yaml.AliasNode:
+		return d.value(n.Alias, path)
+	case yaml.MappingNode:
+		obj := make(map[string]interface{})
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			child := joinPath(path, key.Value)
+			if key.Kind != yaml.ScalarNode {
+				d.problems = append(d.problems, Problem{Path: path, Pos: Position{Line: key.Line, Column: key.Column},
+					Message: "keys have to be strings"})
+				continue
+			}
+			if _, ok := obj[key.Value]; ok {
+				d.problems = append(d.problems, Problem{Path: child, Pos: Position{Line: key.Line, Column: key.Column},
+					Message: fmt.Sprintf("duplicate key %q", key.Value)})
+				continue
+			}
+			d.positions[child] = Position{Line: key.Line, Column: key.Column}
+			obj[key.Value] = d.value(value, child)
+		}
+		return obj
+	case yaml.SequenceNode:
+		list := make([]interface{}, len(n.Content))
+		for i, item := range n.Content {
+			list[i] = d.value(item, indexPath(path, i))
+		}
+		return list
+	case yaml.ScalarNode:
+		v, err := yamlScalar(n)
+		if err != nil {
+			d.problems = append(d.problems, Problem{Path: path, Pos: Position{Line: n.Line, Column: n.Column}, Message: err.Error()})
+		}
+		return v
+	}
+	return nil
+}
+
+func yamlScalar(n *yaml.Node) (interface{}, error) {
+	switch n.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var b bool
+		err := n.Decode(&b)
+		return b, err
+	case "!!int":
+		var i int64
+		if err := n.Decode(&i); err != nil {
+			return nil, err
+		}
+		return json.Number(strconv.FormatInt(i, 10)), nil
+	case "!!float":
+		var f float64
+		if err := n.Decode(&f); err != nil {
+			return nil, err
+		}
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, fmt.Errorf("%s isn't a number JSON allows", n.Value)
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+	case "!!timestamp":
+		var t time.Time
+		if err := n.Decode(&t); err != nil {
+			return nil, err
+		}
+		return t.Format(time.RFC3339Nano), nil
+	default:
+		return n.Value, nil
+	}
+}
+
+func decodeTOML(data []byte) (interface{}, positions, Problems) {
+	var doc map[string]interface{}
+	if _, err := toml.Decode(string(data), &doc); err != nil {
+		var parseErr toml.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, nil, Problems{{Pos: offsetPosition(data, parseErr.Position.Start), Message: parseErr.Message}}
+		}
+		return nil, nil, Problems{{Message: err.Error()}}
+	}
+	// TOML keeps no positions, so problems are reported by their paths.
+	return fromTOML(doc), positions{}, nil
+}
+
+func fromTOML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = fromTOML(value)
+		}
+		return v
+	case []map[string]interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = fromTOML(item)
+		}
+		return list
+	case []interface{}:
+		for i, item := range v {
+			v[i] = fromTOML(item)
+		}
+		return v
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10))
+	case float64:
+		return json.Number(strconv.FormatFloat(v, 'g', -1, 64))
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return v
+	}
+}
+
+// tomlValue prepares a generic document for the TOML encoder, which has no
+// null and needs numbers as Go numbers. The encoder sorts the keys of maps, so
+// objects become structs with the keys in the order of the fields of t, like
+// writeOrdered. TOML still puts tables after the other keys.
+func tomlValue(t reflect.Type, v interface{}) interface{} {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		var fields []reflect.StructField
+		var values []reflect.Value
+		for _, key := range orderedKeys(t, v) {
+			if v[key] == nil {
+				continue
+			}
+			value := reflect.ValueOf(tomlValue(fieldType(t, key), v[key]))
+			fields = append(fields, reflect.StructField{
+				Name: fmt.Sprintf("F%d", len(fields)),
+				Type: value.Type(),
+				Tag:  reflect.StructTag(fmt.Sprintf("toml:%q", key)),
+			})
+			values = append(values, value)
+		}
+		obj := reflect.New(reflect.StructOf(fields)).Elem()
+		for i, value := range values {
+			obj.Field(i).Set(value)
+		}
+		return obj.Interface()
+	case []interface{}:
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = tomlValue(elem, item)
+		}
+		return list
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	default:
+		return v
+	}
+}
+
+// yamlNode builds a YAML tree of a generic document with keys in the order
+// of the fields of t, like writeOrdered.
+func yamlNode(t reflect.Type, v interface{}) *yaml.Node {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		n := &yaml.Node{Kind: yaml.MappingNode}
+		for _, key := range orderedKeys(t, v) {
+			n.Content = append(n.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+				yamlNode(fieldType(t, key), v[key]))
+		}
+		return n
+	case []interface{}:
+		n := &yaml.Node{Kind: yaml.SequenceNode}
+		if isScalarList(v) {
+			n.Style = yaml.FlowStyle
+		}
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		for _, item := range v {
+			n.Content = append(n.Content, yamlNode(elem, item))
+		}
+		return n
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+	case json.Number:
+		tag := "!!int"
+		if _, err := v.Int64(); err != nil {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: v.String()}
+	default:
+		var n yaml.Node
+		n.Encode(v)
+		return &n
+	}
+}
@@ -0,0 +1,129 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+const formatTestJSON = `{
+  "version": 2,
+  "chats": [
+    {
+      "id": 1,
+      "aliases": ["First"],
+      "child_chats": [
+        {"id": 10, "aliases": ["Tenth"]}
+      ]
+    }
+  ],
+  "help_contacts": ["@Karas"],
+  "logging": {"level": "info", "verbose_until": null}
+}`
+
+func TestParseConfigAsYAMLReportsPositions(t *testing.T) {
+	data := `version: 2
+# Comments are allowed.
+chats:
+  - id: 1
+    alias: [First]
+    child_chats:
+      - {id: "12", aliases: [Twelfth]}
+help_contacts: ['@Karas']
+`
+
+	_, problems := ParseConfigAs([]byte(data), FormatYAML)
+
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	want := []string{
+		`5:5: chats[0].alias: unknown field "alias", did you mean "aliases"?`,
+		`7:10: chats[0].child_chats[0].id: expected an integer, got the string "12"`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Wrong problems, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestParseConfigAsTOMLReportsPaths(t *testing.T) {
+	data := `version = 2
+help_contacts = []
+
+[[chats]]
+id = 1
+aliases = ["First", "Chat \"One\""]
+`
+
+	_, problems := ParseConfigAs([]byte(data), FormatTOML)
+
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	want := []string{
+		`chats[0].aliases[1]: alias "Chat \"One\"" contains quotes`,
+		`help_contacts: no help contacts, /help would name nobody to ask`,
+	}
+	if diff := cmp.Diff(want, got, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+		t.Errorf("Wrong problems, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestParseConfigAsSyntaxErrors(t *testing.T) {
+	for format, data := range map[Format]string{
+		FormatYAML: "chats:\n  - id: 1\n   aliases: [First]\n",
+		FormatTOML: "version = 2\nchats = [\n",
+	} {
+		_, problems := ParseConfigAs([]byte(data), format)
+
+		if len(problems) != 1 || problems[0].Pos.Line == 0 {
+			t.Errorf("%s: expected a single syntax error with a line, got %v", format, problems)
+		}
+	}
+}
+
+func TestConvertConfigRoundTrip(t *testing.T) {
+	want, wantProblems := ParseConfig([]byte(formatTestJSON))
+	if len(wantProblems) != 0 {
+		t.Fatalf("Unexpected problems: %v", wantProblems)
+	}
+
+	for _, format := range []Format{FormatYAML, FormatTOML} {
+		converted, err := ConvertConfig([]byte(formatTestJSON), FormatJSON, format)
+		if err != nil {
+			t.Fatalf("ConvertConfig to %s failed: %v", format, err)
+		}
+		got, problems := ParseConfigAs(converted, format)
+		if len(problems) != 0 {
+			t.Errorf("%s: unexpected problems %v in\n%s", format, problems, converted)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("%s: config changed in conversion, cmp.Diff(want, got):\n%s", format, diff)
+		}
+
+		back, err := ConvertConfig(converted, format, FormatJSON)
+		if err != nil {
+			t.Fatalf("ConvertConfig from %s failed: %v", format, err)
+		}
+		if _, problems := ParseConfig(back); len(problems) != 0 {
+			t.Errorf("%s: unexpected problems %v after converting back to\n%s", format, problems, back)
+		}
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	for name, want := range map[string]Format{
+		"config.json":        FormatJSON,
+		"config":             FormatJSON,
+		"dir.d/config.YAML":  FormatYAML,
+		"config.yml":         FormatYAML,
+		"/etc/retg/bot.toml": FormatTOML,
+	} {
+		if got := FormatOf(name); got != want {
+			t.Errorf("FormatOf(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ConfigDiff is the routing impact of changing a config: which chats the
+// tags reach now from which chats, which chats appeared or went away, which
+// ACLs changed and which alias collisions the change introduced.
+type ConfigDiff struct {
+	AddedChats   []DiffChat     `json:"added_chats"`
+	RemovedChats []DiffChat     `json:"removed_chats"`
+	Routes       []RouteDiff    `json:"routes"`
+	ACLs         []ACLDiff      `json:"acls"`
+	Collisions   []AliasOverlap `json:"collisions"`
+	// prefix is the prefix tags are written with, the first one of the new
+	// config.
+	prefix string
+}
+
+// DiffChat identifies a chat in a ConfigDiff.
+type DiffChat struct {
+	ID      int64    `json:"id"`
+	Title   string   `json:"title,omitempty"`
+	Aliases []string `json:"aliases"`
+}
+
+// RouteDiff lists the chats a message tagged with an alias in any of the
+// chats From is delivered to after the change and wasn't before, and the
+// other way round, ACLs included.
+type RouteDiff struct {
+	Alias   string  `json:"alias"`
+	From    []int64 `json:"from"`
+	Added   []int64 `json:"added"`
+	Removed []int64 `json:"removed"`
+}
+
+// ACLDiff lists the AcceptFrom references of a chat added and removed.
+type ACLDiff struct {
+	ChatID  int64    `json:"chat_id"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// Empty reports whether the change doesn't affect routing.
+func (d ConfigDiff) Empty() bool {
+	return len(d.AddedChats) == 0 && len(d.RemovedChats) == 0 && len(d.Routes) == 0 &&
+		len(d.ACLs) == 0 && len(d.Collisions) == 0
+}
+
+// DiffConfigs compares the routing of two configs.
+func DiffConfigs(old, new Config) ConfigDiff {
+	d := ConfigDiff{
+		AddedChats:   []DiffChat{},
+		RemovedChats: []DiffChat{},
+		Routes:       []RouteDiff{},
+		ACLs:         []ACLDiff{},
+		Collisions:   []AliasOverlap{},
+		prefix:       new.Prefixes()[0],
+	}
+
+	oldChats, newChats := chatsByID(old), chatsByID(new)
+	for _, chat := range new.AllChats() {
+		if _, ok := oldChats[chat.ID]; !ok {
+			d.AddedChats = append(d.AddedChats, DiffChat{ID: chat.ID, Title: chat.Title, Aliases: chat.AliasNames()})
+		}
+	}
+	for _, chat := range old.AllChats() {
+		if _, ok := newChats[chat.ID]; !ok {
+			d.RemovedChats = append(d.RemovedChats, DiffChat{ID: chat.ID, Title: chat.Title, Aliases: chat.AliasNames()})
+		}
+	}
+
+	d.Routes = diffRoutes(old, new)
+
+	for _, chat := range new.AllChats() {
+		added, removed := stringSetDiff(chat.AcceptFrom, oldChats[chat.ID].AcceptFrom),
+			stringSetDiff(oldChats[chat.ID].AcceptFrom, chat.AcceptFrom)
+		if len(added) > 0 || len(removed) > 0 {
+			d.ACLs = append(d.ACLs, ACLDiff{ChatID: chat.ID, Added: added, Removed: removed})
+		}
+	}
+
+	oldOverlaps := make(map[string]bool)
+	for _, o := range aliasOverlaps(old.AllAliases()) {
+		oldOverlaps[strings.ToLower(o.Long+"*"+o.Short)] = true
+	}
+	for _, o := range aliasOverlaps(new.AllAliases()) {
+		if !oldOverlaps[strings.ToLower(o.Long+"*"+o.Short)] {
+			d.Collisions = append(d.Collisions, o)
+		}
+	}
+	return d
+}
+
+// String renders the diff for people, one change per line.
+func (d ConfigDiff) String() string {
+	if d.Empty() {
+		return "No routing changes.\n"
+	}
+	var b strings.Builder
+	for _, chat := range d.AddedChats {
+		fmt.Fprintf(&b, "+ chat %s\n", chat.format(d.tag))
+	}
+	for _, chat := range d.RemovedChats {
+		fmt.Fprintf(&b, "- chat %s\n", chat.format(d.tag))
+	}
+	for _, r := range d.Routes {
+		from := make([]string, len(r.From))
+		for i, id := range r.From {
+			from[i] = fmt.Sprint(id)
+		}
+		fmt.Fprintf(&b, "~ %s from %s:%s%s\n", d.tag(r.Alias), strings.Join(from, ", "),
+			formatIDs(" +", r.Added), formatIDs(" -", r.Removed))
+	}
+	for _, acl := range d.ACLs {
+		fmt.Fprintf(&b, "~ chat %d accepts from:", acl.ChatID)
+		for _, ref := range acl.Added {
+			b.WriteString(" +" + ref)
+		}
+		for _, ref := range acl.Removed {
+			b.WriteString(" -" + ref)
+		}
+		b.WriteByte('\n')
+	}
+	for _, o := range d.Collisions {
+		if o.Prefix {
+			fmt.Fprintf(&b, "! alias %q starts with alias %q, so %s also tags %s\n", o.Long, o.Short, d.tag(o.Long), d.tag(o.Short))
+		} else {
+			fmt.Fprintf(&b, "! alias %q contains alias %q\n", o.Long, o.Short)
+		}
+	}
+	return b.String()
+}
+
+// tag writes alias as a tag with the prefix of the new config.
+func (d ConfigDiff) tag(alias string) string {
+	if d.prefix == "" {
+		return Tag(alias)
+	}
+	return TagWith(d.prefix, alias)
+}
+
+// format names the chat by its ID and title with its aliases written by tag.
+func (c DiffChat) format(tag func(alias string) string) string {
+	s := fmt.Sprint(c.ID)
+	if c.Title != "" {
+		s += " " + c.Title
+	}
+	for _, alias := range c.Aliases {
+		s += " " + tag(alias)
+	}
+	return s
+}
+
+func formatIDs(sign string, ids []int64) string {
+	var s string
+	for _, id := range ids {
+		s += fmt.Sprintf("%s%d", sign, id)
+	}
+	return s
+}
+
+// diffRoutes compares where a message tagged with every alias of either
+// config goes from every chat of both: to the chats of the alias accepting
+// messages from the chat, like Router.Route. Only the chats whose aliases or
+// ACL changed are looked at. Sources with the same changes for an alias are
+// listed together.
+func diffRoutes(old, new Config) []RouteDiff {
+	oldIndex, newIndex := NewIndex(old), NewIndex(new)
+	var sources []int64
+	seen := make(map[int64]bool)
+	for _, chat := range newIndex.Chats() {
+		if _, ok := oldIndex.Node(chat.ID); ok && !seen[chat.ID] {
+			seen[chat.ID] = true
+			sources = append(sources, chat.ID)
+		}
+	}
+
+	routes := []RouteDiff{}
+	for _, alias := range mergeAliases(newIndex.Aliases(), oldIndex.Aliases()) {
+		before, after := oldIndex.AliasChatIDs(alias), newIndex.AliasChatIDs(alias)
+		wasIn, isIn := int64Set(before), int64Set(after)
+		changed := append(append([]int64{}, before...), int64SetDiff(after, before)...)
+		sort.Slice(changed, func(i, j int) bool { return changed[i] < changed[j] })
+
+		changes := make(map[int64]*RouteDiff)
+		for _, id := range changed {
+			if wasIn[id] && isIn[id] && sameACL(oldIndex, newIndex, id) {
+				continue
+			}
+			for _, from := range sources {
+				was, is := wasIn[id] && oldIndex.Accepts(id, from), isIn[id] && newIndex.Accepts(id, from)
+				if was == is {
+					continue
+				}
+				c, ok := changes[from]
+				if !ok {
+					c = &RouteDiff{Alias: alias, Added: []int64{}, Removed: []int64{}}
+					changes[from] = c
+				}
+				if is {
+					c.Added = append(c.Added, id)
+				} else {
+					c.Removed = append(c.Removed, id)
+				}
+			}
+		}
+
+		byChange := make(map[string]int)
+		for _, from := range sources {
+			c, ok := changes[from]
+			if !ok {
+				continue
+			}
+			change := fmt.Sprint(c.Added, c.Removed)
+			if i, ok := byChange[change]; ok {
+				routes[i].From = append(routes[i].From, from)
+				continue
+			}
+			byChange[change] = len(routes)
+			c.From = []int64{from}
+			routes = append(routes, *c)
+		}
+	}
+	return routes
+}
+
+// sameACL reports whether the chat accepts messages from the same chats in
+// both indexes.
+func sameACL(a, b *Index, chatID int64) bool {
+	aSources, aOK := a.accepts[chatID]
+	bSources, bOK := b.accepts[chatID]
+	if aOK != bOK || len(aSources) != len(bSources) {
+		return false
+	}
+	for id := range aSources {
+		if !bSources[id] {
+			return false
+		}
+	}
+	return true
+}
+
+func int64Set(ids []int64) map[int64]bool {
+	set := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+func chatsByID(config Config) map[int64]Chat {
+	chats := make(map[int64]Chat)
+	for _, chat := range config.AllChats() {
+		chats[chat.ID] = chat
+	}
+	return chats
+}
+
+// mergeAliases returns the distinct aliases of both lists, sorted like
+// AllAliases.
+func mergeAliases(a, b []string) []string {
+	seen := make(map[string]bool)
+	var merged []string
+	for _, alias := range append(append([]string{}, a...), b...) {
+		if key := strings.ToLower(alias); !seen[key] {
+			seen[key] = true
+			merged = append(merged, alias)
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return strings.ToLower(merged[i]) < strings.ToLower(merged[j])
+	})
+	return merged
+}
+
+// int64SetDiff returns the items of a missing from b.
+func int64SetDiff(a, b []int64) []int64 {
+	in := make(map[int64]bool)
+	for _, x := range b {
+		in[x] = true
+	}
+	diff := []int64{}
+	for _, x := range a {
+		if !in[x] {
+			diff = append(diff, x)
+		}
+	}
+	return diff
+}
+
+// stringSetDiff returns the items of a missing from b, ignoring case and the
+// leading "*".
+func stringSetDiff(a, b []string) []string {
+	in := make(map[string]bool)
+	for _, x := range b {
+		in[strings.ToLower(strings.TrimPrefix(x, "*"))] = true
+	}
+	diff := []string{}
+	for _, x := range a {
+		if !in[strings.ToLower(strings.TrimPrefix(x, "*"))] {
+			diff = append(diff, x)
+		}
+	}
+	return diff
+}
@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	old := Config{Chats: []Chat{
+		{ID: 1, Aliases: NewAliases("First", "All")},
+		{ID: 2, Aliases: NewAliases("Second", "All"), AcceptFrom: []string{"First"}},
+		{ID: 3, Aliases: NewAliases("Third")},
+		{ID: 5, Aliases: NewAliases("Fifth"), AcceptFrom: []string{"Third"}},
+	}}
+	new := Config{Chats: []Chat{
+		{ID: 1, Aliases: NewAliases("First", "All", "Sec")},
+		{ID: 2, Aliases: NewAliases("Second"), AcceptFrom: []string{"*first", "Fourth"}},
+		{ID: 4, Title: "Fourth chat", Aliases: NewAliases("Fourth", "All")},
+		{ID: 5, Aliases: NewAliases("Fifth"), AcceptFrom: []string{"First"}},
+	}}
+
+	got := DiffConfigs(old, new)
+
+	// Only the ACL of chat 5 changes, yet *Fifth reaches it from chat 1 now.
+
+	want := ConfigDiff{
+		AddedChats:   []DiffChat{{ID: 4, Title: "Fourth chat", Aliases: []string{"Fourth", "All"}}},
+		RemovedChats: []DiffChat{{ID: 3, Aliases: []string{"Third"}}},
+		Routes: []RouteDiff{
+			{Alias: "All", From: []int64{1}, Added: []int64{4}, Removed: []int64{2}},
+			{Alias: "All", From: []int64{2, 5}, Added: []int64{4}, Removed: []int64{}},
+			{Alias: "Fifth", From: []int64{1}, Added: []int64{5}, Removed: []int64{}},
+			{Alias: "Fourth", From: []int64{1, 2, 5}, Added: []int64{4}, Removed: []int64{}},
+			{Alias: "Sec", From: []int64{1, 2, 5}, Added: []int64{1}, Removed: []int64{}},
+			{Alias: "Third", From: []int64{1, 2, 5}, Added: []int64{}, Removed: []int64{3}},
+		},
+		ACLs: []ACLDiff{
+			{ChatID: 2, Added: []string{"Fourth"}, Removed: []string{}},
+			{ChatID: 5, Added: []string{"First"}, Removed: []string{"Third"}},
+		},
+		Collisions: []AliasOverlap{{Long: "Second", Short: "Sec", Prefix: true}},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(ConfigDiff{})); diff != "" {
+		t.Errorf("Wrong diff, cmp.Diff(want, got):\n%s", diff)
+	}
+
+	wantText := `+ chat 4 Fourth chat *Fourth *All
+- chat 3 *Third
+~ *All from 1: +4 -2
+~ *All from 2, 5: +4
+~ *Fifth from 1: +5
+~ *Fourth from 1, 2, 5: +4
+~ *Sec from 1, 2, 5: +1
+~ *Third from 1, 2, 5: -3
+~ chat 2 accepts from: +Fourth
+~ chat 5 accepts from: +First -Third
+! alias "Second" starts with alias "Sec", so *Second also tags *Sec
+`
+	if diff := cmp.Diff(wantText, got.String()); diff != "" {
+		t.Errorf("Wrong text, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestDiffConfigsWithoutChanges(t *testing.T) {
+	if d := DiffConfigs(config, config); !d.Empty() {
+		t.Errorf("Expected no changes between equal configs, got:\n%s", d)
+	}
+}
+
+func TestDiffConfigsWritesTagsWithThePrefix(t *testing.T) {
+	old := Config{TagPrefixes: []string{"#"}, Chats: []Chat{
+		{ID: 1, Aliases: NewAliases("First")},
+	}}
+	new := Config{TagPrefixes: []string{"#", "*"}, Chats: []Chat{
+		{ID: 1, Aliases: NewAliases("First", "Old Town")},
+		{ID: 2, Aliases: NewAliases("Old Town Hall")},
+	}}
+
+	want := `+ chat 2 #Old_Town_Hall
+~ #Old_Town from 1: +1
+~ #Old_Town_Hall from 1: +2
+! alias "Old Town Hall" starts with alias "Old Town", so #Old_Town_Hall also tags #Old_Town
+`
+	if diff := cmp.Diff(want, DiffConfigs(old, new).String()); diff != "" {
+		t.Errorf("Wrong text, cmp.Diff(want, got):\n%s", diff)
+	}
+}
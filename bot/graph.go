@@ -0,0 +1,200 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// graph is the chat tree prepared for rendering: chats with their parent
+// links, aliases shared by several chats and ACL edges.
+type graph struct {
+	index   *Index
+	chats   []graphChat
+	shared  []sharedAlias
+	accepts []graphEdge
+}
+
+type graphChat struct {
+	Chat
+	parent int64
+	label  string
+}
+
+type sharedAlias struct {
+	alias   string
+	chatIDs []int64
+}
+
+type graphEdge struct {
+	from, to int64
+}
+
+func (config Config) graph() graph {
+	var g graph
+	var walk func(chats []Chat, parent int64)
+	walk = func(chats []Chat, parent int64) {
+		for _, chat := range chats {
+			g.chats = append(g.chats, graphChat{Chat: chat, parent: parent, label: chatLabel(chat)})
+			walk(chat.ChildChats, chat.ID)
+		}
+	}
+	walk(config.Chats, 0)
+
+	ix := NewIndex(config)
+	g.index = ix
+	for _, alias := range ix.Aliases() {
+		if ids := ix.AliasChatIDs(alias); len(ids) > 1 {
+			g.shared = append(g.shared, sharedAlias{alias: alias, chatIDs: ids})
+		}
+	}
+
+	for _, chat := range g.chats {
+		seen := make(map[int64]bool)
+		for _, ref := range chat.AcceptFrom {
+			ids, _ := ix.ChatsByRef(ref)
+			for _, id := range ids {
+				if !seen[id] {
+					seen[id] = true
+					g.accepts = append(g.accepts, graphEdge{from: id, to: chat.ID})
+				}
+			}
+		}
+	}
+	return g
+}
+
+// chatLabel names a chat by its title, or by its ID if it has none.
+func chatLabel(chat Chat) string {
+	if chat.Title != "" {
+		return chat.Title
+	}
+	return fmt.Sprint(chat.ID)
+}
+
+// chatTags writes the aliases of the chat as tags with its first prefix.
+func chatTags(ix *Index, chat Chat) string {
+	tags := make([]string, len(chat.Aliases))
+	for i, alias := range chat.AliasNames() {
+		tags[i] = ix.ChatTag(chat.ID, alias)
+	}
+	return strings.Join(tags, " ")
+}
+
+// sharedTag writes a shared alias as a tag with the first prefix of the
+// config.
+func (g graph) sharedTag(alias string) string {
+	return TagWith(g.index.prefixes[0], alias)
+}
+
+func graphChatNode(id int64) string {
+	return "chat_" + strings.Replace(fmt.Sprint(id), "-", "m", 1)
+}
+
+// DOT renders the chat tree as a Graphviz digraph. Solid edges lead from
+// parent chats to their children, dashed ones from aliases shared by several
+// chats to those chats, and dotted ones from chats to the chats that accept
+// their messages by AcceptFrom.
+func (config Config) DOT() string {
+	g := config.graph()
+	var b strings.Builder
+	b.WriteString("digraph chats {\n")
+	b.WriteString("  node [shape=box];\n")
+	for _, chat := range g.chats {
+		fmt.Fprintf(&b, "  %s [label=%s];\n", graphChatNode(chat.ID), dotQuote(chat.label+"\n"+chatTags(g.index, chat.Chat)))
+	}
+	for _, chat := range g.chats {
+		if chat.parent != 0 {
+			fmt.Fprintf(&b, "  %s -> %s;\n", graphChatNode(chat.parent), graphChatNode(chat.ID))
+		}
+	}
+	for i, shared := range g.shared {
+		node := fmt.Sprintf("alias_%d", i)
+		fmt.Fprintf(&b, "  %s [label=%s, shape=ellipse, style=dashed];\n", node, dotQuote(g.sharedTag(shared.alias)))
+		for _, id := range shared.chatIDs {
+			fmt.Fprintf(&b, "  %s -> %s [style=dashed];\n", node, graphChatNode(id))
+		}
+	}
+	for _, edge := range g.accepts {
+		fmt.Fprintf(&b, "  %s -> %s [style=dotted, color=red, label=\"accepts\"];\n", graphChatNode(edge.from), graphChatNode(edge.to))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func dotQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+	return `"` + s + `"`
+}
+
+// Mermaid renders the chat tree as a Mermaid flowchart with the same nodes
+// and edges as DOT.
+func (config Config) Mermaid() string {
+	g := config.graph()
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+	for _, chat := range g.chats {
+		fmt.Fprintf(&b, "  %s[%s]\n", graphChatNode(chat.ID), mermaidQuote(chat.label+"\n"+chatTags(g.index, chat.Chat)))
+	}
+	for _, chat := range g.chats {
+		if chat.parent != 0 {
+			fmt.Fprintf(&b, "  %s --> %s\n", graphChatNode(chat.parent), graphChatNode(chat.ID))
+		}
+	}
+	for i, shared := range g.shared {
+		node := fmt.Sprintf("alias_%d", i)
+		fmt.Fprintf(&b, "  %s([%s])\n", node, mermaidQuote(g.sharedTag(shared.alias)))
+		for _, id := range shared.chatIDs {
+			fmt.Fprintf(&b, "  %s -.-> %s\n", node, graphChatNode(id))
+		}
+	}
+	for _, edge := range g.accepts {
+		fmt.Fprintf(&b, "  %s -. accepts .-> %s\n", graphChatNode(edge.from), graphChatNode(edge.to))
+	}
+	return b.String()
+}
+
+func mermaidQuote(s string) string {
+	s = strings.NewReplacer(`"`, "#quot;", "\n", "<br/>").Replace(s)
+	return `"` + s + `"`
+}
+
+// TextTree renders the chat tree as indented text with the tags of every
+// chat, the shared tags and the ACLs.
+func (config Config) TextTree() string {
+	g := config.graph()
+	var b strings.Builder
+	var walk func(chats []Chat, prefix string)
+	walk = func(chats []Chat, prefix string) {
+		for i, chat := range chats {
+			branch, indent := "├─ ", "│  "
+			if i == len(chats)-1 {
+				branch, indent = "└─ ", "   "
+			}
+			b.WriteString(prefix + branch + chatLabel(chat))
+			if tags := chatTags(g.index, chat); tags != "" {
+				b.WriteString(" " + tags)
+			}
+			if len(chat.AcceptFrom) > 0 {
+				b.WriteString(" (accepts from " + strings.Join(chat.AcceptFrom, ", ") + ")")
+			}
+			b.WriteByte('\n')
+			walk(chat.ChildChats, prefix+indent)
+		}
+	}
+	walk(config.Chats, "")
+
+	if len(g.shared) > 0 {
+		b.WriteString("\nShared tags:\n")
+		for _, shared := range g.shared {
+			var labels []string
+			for _, id := range shared.chatIDs {
+				node, _ := g.index.Node(id)
+				labels = append(labels, chatLabel(node.Chat))
+			}
+			sort.Strings(labels)
+			fmt.Fprintf(&b, "%s: %s\n", g.sharedTag(shared.alias), strings.Join(labels, ", "))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,66 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var graphConfig = Config{
+	Chats: []Chat{
+		{ID: 1, Title: `The "First"`, Aliases: NewAliases("First", "All"),
+			ChildChats: []Chat{
+				{ID: -10, Aliases: NewAliases("Tenth", "All"), AcceptFrom: []string{"First"}},
+			},
+		},
+	},
+}
+
+func TestDOT(t *testing.T) {
+	want := `digraph chats {
+  node [shape=box];
+  chat_1 [label="The \"First\"\n*First *All"];
+  chat_m10 [label="-10\n*Tenth *All"];
+  chat_1 -> chat_m10;
+  alias_0 [label="*All", shape=ellipse, style=dashed];
+  alias_0 -> chat_1 [style=dashed];
+  alias_0 -> chat_m10 [style=dashed];
+  chat_1 -> chat_m10 [style=dotted, color=red, label="accepts"];
+}
+`
+	if diff := cmp.Diff(want, graphConfig.DOT()); diff != "" {
+		t.Errorf("Wrong DOT, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestMermaid(t *testing.T) {
+	want := `flowchart TD
+  chat_1["The #quot;First#quot;<br/>*First *All"]
+  chat_m10["-10<br/>*Tenth *All"]
+  chat_1 --> chat_m10
+  alias_0(["*All"])
+  alias_0 -.-> chat_1
+  alias_0 -.-> chat_m10
+  chat_1 -. accepts .-> chat_m10
+`
+	if diff := cmp.Diff(want, graphConfig.Mermaid()); diff != "" {
+		t.Errorf("Wrong Mermaid, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestTextTree(t *testing.T) {
+	want := `├─ 1 *First *All *SingleDigit
+│  ├─ 10 *Tenth *All *DoubleDigit
+│  │  └─ 100 *Hundreadth *All *TripleDigit
+│  └─ 11 *Eleventh *All *DoubleDigit
+└─ 2 *Second *All *SingleDigit
+
+Shared tags:
+*All: 1, 10, 100, 11, 2
+*DoubleDigit: 10, 11
+*SingleDigit: 1, 2
+`
+	if diff := cmp.Diff(want, config.TextTree()); diff != "" {
+		t.Errorf("Wrong tree, cmp.Diff(want, got):\n%s", diff)
+	}
+}
@@ -0,0 +1,152 @@
+package bot
+
+import "strings"
+
+// Group is a named set of chats defined apart from the chat tree, tagged by
+// its name like an alias. A chat is in the group if it's listed in Chats, is
+// in the subtree of a chat listed in Subtrees or is in a group of Union, and
+// isn't in any group of Difference.
+type Group struct {
+	Name string `json:"name"`
+	// Description tells users what the tag is for, like Alias.Description.
+	Description string `json:"description,omitempty"`
+	// Hidden groups tag their chats but aren't suggested.
+	Hidden bool `json:"hidden,omitempty"`
+	// Chats are IDs of chats in the group.
+	Chats []int64 `json:"chats,omitempty"`
+	// Subtrees are IDs of chats in the group along with all their
+	// descendants.
+	Subtrees []int64 `json:"subtrees,omitempty"`
+	// Union names other groups whose chats are in the group.
+	Union []string `json:"union,omitempty"`
+	// Difference names other groups whose chats are left out of the group.
+	Difference []string `json:"difference,omitempty"`
+}
+
+// Alias returns the alias the group is tagged by.
+func (g Group) Alias() Alias {
+	return Alias{Name: g.Name, Description: g.Description, Hidden: g.Hidden}
+}
+
+// refs returns the names of the groups g is defined by.
+func (g Group) refs() []string {
+	return append(append([]string(nil), g.Union...), g.Difference...)
+}
+
+// GroupChatIDs maps every lowercased group name to the IDs of the chats in
+// the group, in the order of AllChats. Unknown chats and groups, and groups
+// depending on themselves, add no chats; Validate reports them.
+func (config Config) GroupChatIDs() map[string][]int64 {
+	groups := config.groupsByName()
+	chats := config.AllChats()
+	subtrees := make(map[int64][]Chat)
+	for _, chat := range chats {
+		if _, ok := subtrees[chat.ID]; !ok {
+			subtrees[chat.ID] = Config{Chats: []Chat{chat}}.AllChats()
+		}
+	}
+
+	members := make(map[string]map[int64]bool)
+	resolving := make(map[string]bool)
+	var resolve func(name string) map[int64]bool
+	resolve = func(name string) map[int64]bool {
+		key := groupKey(name)
+		if m, ok := members[key]; ok {
+			return m
+		}
+		g, ok := groups[key]
+		if !ok || resolving[key] {
+			return nil
+		}
+		resolving[key] = true
+		m := make(map[int64]bool)
+		for _, id := range g.Chats {
+			m[id] = true
+		}
+		for _, id := range g.Subtrees {
+			for _, chat := range subtrees[id] {
+				m[chat.ID] = true
+			}
+		}
+		for _, ref := range g.Union {
+			for id := range resolve(ref) {
+				m[id] = true
+			}
+		}
+		for _, ref := range g.Difference {
+			for id := range resolve(ref) {
+				delete(m, id)
+			}
+		}
+		resolving[key] = false
+		members[key] = m
+		return m
+	}
+
+	index := make(map[string][]int64)
+	for key := range groups {
+		m := resolve(key)
+		ids := []int64{}
+		seen := make(map[int64]bool)
+		for _, chat := range chats {
+			if m[chat.ID] && !seen[chat.ID] {
+				seen[chat.ID] = true
+				ids = append(ids, chat.ID)
+			}
+		}
+		index[key] = ids
+	}
+	return index
+}
+
+// groupsByName maps lowercased names to the groups, the first one of each
+// name.
+func (config Config) groupsByName() map[string]Group {
+	groups := make(map[string]Group)
+	for _, g := range config.Groups {
+		if _, ok := groups[groupKey(g.Name)]; !ok {
+			groups[groupKey(g.Name)] = g
+		}
+	}
+	return groups
+}
+
+// groupKey is the lowercased name a group is referred to by, with or without
+// the leading "*".
+func groupKey(name string) string {
+	return strings.ToLower(strings.TrimPrefix(name, "*"))
+}
+
+// groupCycle returns the names of groups from start back to it through the
+// groups they're defined by, or nil if start doesn't depend on itself.
+func groupCycle(groups map[string]Group, start string) []string {
+	visited := make(map[string]bool)
+	var path []string
+	var walk func(key string) bool
+	walk = func(key string) bool {
+		g, ok := groups[key]
+		if !ok {
+			return false
+		}
+		path = append(path, g.Name)
+		for _, ref := range g.refs() {
+			next := groupKey(ref)
+			if next == groupKey(start) {
+				path = append(path, groups[next].Name)
+				return true
+			}
+			if !visited[next] {
+				visited[next] = true
+				if walk(next) {
+					return true
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	if walk(groupKey(start)) {
+		return path
+	}
+	return nil
+}
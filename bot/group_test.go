@@ -0,0 +1,55 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGroupChatIDs(t *testing.T) {
+	groups := config
+	groups.Groups = []Group{
+		{Name: "Tens", Subtrees: []int64{10}},
+		{Name: "Ones", Chats: []int64{1, 2}},
+		{Name: "Everyone", Union: []string{"Ones", "*tens"}, Chats: []int64{11}},
+		{Name: "NotTenth", Union: []string{"Everyone"}, Difference: []string{"Tens"}},
+		{Name: "Loop", Union: []string{"Ones", "Loop"}},
+		{Name: "Ghosts", Chats: []int64{404}, Union: []string{"Nobody"}},
+	}
+
+	got := groups.GroupChatIDs()
+
+	want := map[string][]int64{
+		"tens":     {10, 100},
+		"ones":     {1, 2},
+		"everyone": {1, 2, 10, 11, 100},
+		"nottenth": {1, 2, 11},
+		"loop":     {1, 2},
+		"ghosts":   {},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Wrong group chats, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestRouterRoutesGroups(t *testing.T) {
+	groups := config
+	groups.Groups = []Group{{Name: "Tens", Subtrees: []int64{10}}}
+	router := NewRouter(groups)
+
+	plan := router.Route(1, "*tens and *hundreadth")
+
+	want := []Delivery{
+		{ChatID: 10, Aliases: []string{"Tens"}},
+		{ChatID: 100, Aliases: []string{"Hundreadth", "Tens"}},
+	}
+	if diff := cmp.Diff(want, plan.Deliveries); diff != "" {
+		t.Errorf("Wrong deliveries, cmp.Diff(want, got):\n%s", diff)
+	}
+	if got := router.Index().AliasChatIDs("TENS"); !cmp.Equal(got, []int64{10, 100}) {
+		t.Errorf("AliasChatIDs(TENS) = %v, want [10 100]", got)
+	}
+	if ids, _ := router.Index().ChatsByRef("*Tens"); !cmp.Equal(ids, []int64{10, 100}) {
+		t.Errorf("Expected ChatsByRef to find the chats of the group, got %v", ids)
+	}
+}
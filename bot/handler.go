@@ -3,168 +3,248 @@ package bot
 import (
 	"errors"
 	"fmt"
-	"log"
-	"sort"
 	"strings"
-	"unicode"
+	"sync/atomic"
+	"time"
+	"unicode/utf16"
 
+	"github.com/DzyubSpirit/reTGanslatorBot/logging"
+	"github.com/DzyubSpirit/reTGanslatorBot/store"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 )
 
-type Config struct {
-	Chats        []Chat   `json:"chats"`
-	HelpContacts []string `json:"help_contacts"`
-}
-
-type Chat struct {
-	ID         int64    `json:"id"`
-	Aliases    []string `json:"aliases"`
-	ChildChats []Chat   `json:"child_chats"`
-}
-
 type BotAPI interface {
 	AnswerInlineQuery(config tgbotapi.InlineConfig) (tgbotapi.APIResponse, error)
 	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	GetChat(config tgbotapi.ChatConfig) (tgbotapi.Chat, error)
+	AnswerCallbackQuery(config tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error)
+	GetChatMember(config tgbotapi.ChatConfigWithUser) (tgbotapi.ChatMember, error)
+	PinChatMessage(config tgbotapi.PinChatMessageConfig) (tgbotapi.APIResponse, error)
 }
 
+// Handler routes updates. It's safe for concurrent use: HandleUpdate may be
+// called from many goroutines, and copies of a Handler share its state. Its
+// dependencies are set once by NewHandler, and everything that changes at run
+// time is either an immutable snapshot swapped atomically or guarded by a
+// lock. BotAPI and Metrics implementations have to be safe for concurrent use
+// too.
 type Handler struct {
-	bot    BotAPI
+	bot BotAPI
+	// current holds the *snapshot updates are handled with. It's a pointer
+	// so that copies of the Handler see the config swapped by SetConfig.
+	current *atomic.Value
+	titles  *titleCache
+	recent  *recentTags
+	members *memberships
+	hinted  *hintedMessages
+	metrics Metrics
+	logger  *logging.Logger
+}
+
+// snapshot is a config together with what the Handler derives from it. It's
+// never modified, SetConfig swaps it as a whole. An update is handled with the
+// snapshot loaded when handling started.
+type snapshot struct {
 	config Config
+	router Router
+}
+
+func newSnapshot(config Config) *snapshot {
+	return &snapshot{config: config, router: NewRouter(config)}
 }
 
-func NewHandler(config Config, bot BotAPI) *Handler {
-	return &Handler{
-		bot:    bot,
-		config: config,
+// Option configures optional Handler dependencies.
+type Option func(*Handler)
+
+// WithLogger makes the Handler write its logs to logger.
+func WithLogger(logger *logging.Logger) Option {
+	return func(bh *Handler) {
+		bh.logger = logger
 	}
 }
 
-func hasChatTag(chatName, text string) bool {
-	return strings.Contains(strings.ToLower(text), "*"+strings.ToLower(chatName))
+// WithMetrics makes the Handler report its activity to m.
+func WithMetrics(m Metrics) Option {
+	return func(bh *Handler) {
+		bh.metrics = m
+	}
 }
 
-func (config Config) AllAliases() []string {
-	aliases := make(map[string]bool)
-	queue := config.Chats
-	for len(queue) > 0 {
-		chat := queue[0]
-		queue = queue[1:]
+// WithStore makes the Handler keep its state, such as the tags every user
+// sent recently, the chats they're in and the messages hints were given for,
+// in st. It's kept in memory by default.
+func WithStore(st store.Store) Option {
+	return func(bh *Handler) {
+		bh.recent = &recentTags{store: st}
+		bh.members = &memberships{store: st}
+		bh.hinted = &hintedMessages{store: st}
+	}
+}
 
-		for _, alias := range chat.Aliases {
-			aliases[alias] = true
-		}
-		queue = append(queue, chat.ChildChats...)
-	}
-	var aliasesList []string
-	for alias := range aliases {
-		aliasesList = append(aliasesList, alias)
-	}
-	sort.Slice(aliasesList, func(i, j int) bool {
-		return strings.ToLower(aliasesList[i]) < strings.ToLower(aliasesList[j])
-	})
-	return aliasesList
-}
-
-func (config Config) AllChats() []Chat {
-	var allChats []Chat
-	queue := config.Chats
-	for len(queue) > 0 {
-		chat := queue[0]
-		queue = queue[1:]
-
-		allChats = append(allChats, chat)
-		queue = append(queue, chat.ChildChats...)
-	}
-	return allChats
-}
-
-func (bh Handler) inlineQuery(update tgbotapi.Update) {
-	query := *update.InlineQuery
-	aliases := bh.config.AllAliases()
-	for i, alias := range aliases {
-		aliases[i] = "*" + alias
-	}
-	matched := aliases
-	words := strings.Fields(query.Query)
-	withoutLastWord := query.Query
-	if len(words) > 0 {
-		matched = nil
-		lastWord := words[len(words)-1]
-		withoutLastWord = strings.TrimRightFunc(query.Query, unicode.IsSpace)[0 : len(query.Query)-len(lastWord)]
-		for _, alias := range aliases {
-			if strings.Contains(strings.ToLower(alias), strings.ToLower(lastWord)) {
-				matched = append(matched, alias)
-			}
-		}
+func NewHandler(config Config, bot BotAPI, opts ...Option) *Handler {
+	bh := &Handler{
+		bot:     bot,
+		current: &atomic.Value{},
+		titles:  newTitleCache(),
+		recent:  &recentTags{store: store.NewMemory()},
+		members: &memberships{store: store.NewMemory()},
+		hinted:  &hintedMessages{store: store.NewMemory()},
+		metrics: NopMetrics{},
+		logger:  logging.Default(),
 	}
-	var results []interface{}
-	for _, alias := range matched {
-		fullSuggestion := withoutLastWord + alias
-		results = append(results, tgbotapi.NewInlineQueryResultArticle(fullSuggestion, alias, fullSuggestion))
+	bh.current.Store(newSnapshot(config))
+	for _, opt := range opts {
+		opt(bh)
 	}
-	inlineConfig := tgbotapi.InlineConfig{
-		InlineQueryID: query.ID,
-		Results:       results,
+	return bh
+}
+
+func (bh Handler) snapshot() *snapshot {
+	return bh.current.Load().(*snapshot)
+}
+
+// SetConfig makes the Handler route the updates it handles from now on with
+// config. Updates being handled keep the config they started with. The config
+// has to be validated by the caller.
+func (bh Handler) SetConfig(config Config) {
+	bh.current.Store(newSnapshot(config))
+}
+
+func (bh Handler) send(logger *logging.Logger, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	msg, err := bh.bot.Send(c)
+	if err != nil {
+		bh.metrics.SendFailed(ErrorCode(err))
+		logger.Warn("Failed to send", "type", fmt.Sprintf("%T", c), "error", logging.RedactError(err))
 	}
-	bh.bot.AnswerInlineQuery(inlineConfig)
+	return msg, err
+}
+
+// payload returns text as it is if verbose logging is on, redacted otherwise.
+func (current *snapshot) payload(text string) string {
+	if current.config.Logging.Verbose(time.Now()) {
+		return text
+	}
+	return logging.Redact(text)
+}
+
+// Config returns the configuration the Handler routes messages with.
+func (bh Handler) Config() Config {
+	return bh.snapshot().config
 }
 
-func (bh Handler) message(update tgbotapi.Update) {
-	log.Printf("[%s] text: %s, caption: %s", update.Message.From.UserName, update.Message.Text, update.Message.Caption)
+func (bh Handler) message(logger *logging.Logger, update tgbotapi.Update) {
+	current := bh.snapshot()
+	// Channel posts have no sender.
+	if update.Message.From != nil {
+		logger = logger.With("user_id", update.Message.From.ID)
+	}
+	logger.Info("Message received",
+		"text", current.payload(update.Message.Text),
+		"caption", current.payload(update.Message.Caption))
+	if err := bh.trackMembers(current, update.Message); err != nil {
+		logger.Warn("Failed to track chat members", "error", err)
+	}
+	text := TaggedText{Text: update.Message.Text}
 	if update.Message.Entities != nil {
+		text.Hashtags = []string{}
 		for _, entity := range *update.Message.Entities {
-			username := update.Message.Text[entity.Offset : entity.Offset+entity.Length]
-			if entity.Type == "mention" && username == "@reTGanslatorBot" {
-				aliases := bh.config.AllAliases()
+			entityText := messageEntityText(update.Message.Text, entity)
+			if entity.Type == "hashtag" {
+				text.Hashtags = append(text.Hashtags, strings.TrimPrefix(entityText, hashtagPrefix))
+			}
+			if entity.Type == "mention" && entityText == "@reTGanslatorBot" {
+				ix := current.router.Index()
+				aliases := ix.SuggestedAliases()
 				for i, alias := range aliases {
-					aliases[i] = "*" + strings.ToLower(alias)
+					aliases[i] = ix.ChatTag(update.Message.Chat.ID, strings.ToLower(alias))
 				}
 				msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Tags: "+strings.Join(aliases, " "))
 				msg.BaseChat.ReplyToMessageID = update.Message.MessageID
-				bh.bot.Send(msg)
+				bh.send(logger, msg)
 			}
 		}
 	}
 
-	found := false
-	for _, chat := range bh.config.AllChats() {
-		if update.Message.Chat.ID == chat.ID {
-			found = true
-			break
+	plan := current.router.RouteTexts(update.Message.Chat.ID, text, TaggedText{Text: update.Message.Caption})
+	for _, alias := range plan.Aliases {
+		bh.metrics.TagMatched(alias)
+	}
+	if len(plan.Aliases) > 0 && update.Message.From != nil {
+		if err := bh.recent.add(update.Message.From.ID, plan.Aliases...); err != nil {
+			logger.Warn("Failed to remember the tags used", "error", err)
 		}
 	}
-	if !found {
-		return
+
+	plan = bh.authorizeModifiers(logger, current, plan, update.Message)
+	bh.deliver(logger, plan, update.Message)
+	bh.nudgeDeprecated(logger, current, update.Message, plan.Aliases)
+	bh.hintUnknownTags(logger, current, update.Message)
+}
+
+// messageEntityText returns the part of text entity marks. Entities count
+// UTF-16 code units.
+func messageEntityText(text string, entity tgbotapi.MessageEntity) string {
+	units := utf16.Encode([]rune(text))
+	if entity.Offset < 0 || entity.Length < 0 || entity.Offset+entity.Length > len(units) {
+		return ""
 	}
+	return string(utf16.Decode(units[entity.Offset : entity.Offset+entity.Length]))
+}
 
-	for _, chat := range bh.config.AllChats() {
-		hasTags := false
-		for _, alias := range chat.Aliases {
-			if hasChatTag(alias, update.Message.Text) || hasChatTag(alias, update.Message.Caption) {
-				hasTags = true
-				break
-			}
-		}
-		if !hasTags {
-			continue
+// nudgeDeprecated asks the sender of a message to use the new tags instead of
+// the deprecated ones among aliases. The message was delivered anyway.
+func (bh Handler) nudgeDeprecated(logger *logging.Logger, current *snapshot, message *tgbotapi.Message, aliases []string) {
+	var lines []string
+	for _, name := range aliases {
+		if alias, _ := current.router.Index().Alias(name); alias.DeprecatedBy != "" {
+			ix := current.router.Index()
+			lines = append(lines, fmt.Sprintf("Тег %s застарів, використовуйте %s.",
+				ix.ChatTag(message.Chat.ID, name), ix.ChatTag(message.Chat.ID, strings.TrimPrefix(alias.DeprecatedBy, "*"))))
 		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	msg := tgbotapi.NewMessage(message.Chat.ID, strings.Join(lines, "\n"))
+	msg.ReplyToMessageID = message.MessageID
+	bh.send(logger, msg)
+}
 
+// deliver forwards message, and the message it replies to, as planned.
+func (bh Handler) deliver(logger *logging.Logger, plan Plan, message *tgbotapi.Message) {
+	for _, delivery := range plan.Deliveries {
+		// Urgent messages notify even if they're also tagged silently.
+		silent := delivery.Modifiers.Silent && !delivery.Modifiers.Urgent
 		{
-			msg := tgbotapi.NewMessage(chat.ID, "Пересилаю повідомлення з чату "+update.Message.Chat.Title)
-			bh.bot.Send(msg)
+			msg := tgbotapi.NewMessage(delivery.ChatID, "Пересилаю повідомлення з чату "+message.Chat.Title)
+			msg.DisableNotification = silent
+			bh.send(logger, msg)
 		}
-		if update.Message.ReplyToMessage != nil {
-			msg := tgbotapi.NewForward(chat.ID, update.Message.Chat.ID, update.Message.ReplyToMessage.MessageID)
-			bh.bot.Send(msg)
+		if message.ReplyToMessage != nil {
+			msg := tgbotapi.NewForward(delivery.ChatID, message.Chat.ID, message.ReplyToMessage.MessageID)
+			msg.DisableNotification = silent
+			bh.send(logger, msg)
 		}
 		{
-			msg := tgbotapi.NewForward(chat.ID, update.Message.Chat.ID, update.Message.MessageID)
-			bh.bot.Send(msg)
+			msg := tgbotapi.NewForward(delivery.ChatID, message.Chat.ID, message.MessageID)
+			msg.DisableNotification = silent
+			if forwarded, err := bh.send(logger, msg); err == nil {
+				bh.metrics.MessageDelivered(message.Chat.ID, delivery.ChatID)
+				if delivery.Modifiers.IsZero() {
+					logger.Info("Message forwarded", "to_chat_id", delivery.ChatID, "aliases", delivery.Aliases)
+				} else {
+					logger.Info("Message forwarded", "to_chat_id", delivery.ChatID, "aliases", delivery.Aliases,
+						"modifiers", delivery.Modifiers.String())
+				}
+				if delivery.Modifiers.Pin {
+					bh.pin(logger, delivery.ChatID, forwarded.MessageID, silent)
+				}
+			}
 		}
 	}
 }
 
-func (bh Handler) command(update tgbotapi.Update) {
+func (bh Handler) command(logger *logging.Logger, update tgbotapi.Update) {
 	msg := update.Message
 	if msg.CommandWithAt() != msg.Command() {
 		cmd := msg.CommandWithAt()
@@ -174,16 +254,38 @@ func (bh Handler) command(update tgbotapi.Update) {
 			return
 		}
 	}
-	if msg.Command() != "help" {
-		return
+	current := bh.snapshot()
+	switch msg.Command() {
+	case "help":
+		bh.help(logger, msg, current)
+	case "tree":
+		if current.config.TreeCommand {
+			bh.tree(logger, msg, current.config)
+		}
 	}
+}
 
-	aliases := bh.config.AllAliases()
-	for i := range aliases {
-		aliases[i] = "*" + strings.ToLower(aliases[i])
+func (bh Handler) help(logger *logging.Logger, msg *tgbotapi.Message, current *snapshot) {
+	ix := current.router.Index()
+	aliases := ix.SuggestedAliases()
+	described := false
+	for i, name := range aliases {
+		aliases[i] = ix.ChatTag(msg.Chat.ID, strings.ToLower(name))
+		if alias, _ := ix.Alias(name); alias.Description != "" {
+			aliases[i] += " — " + alias.Description
+			described = true
+		}
 	}
+	// Tags with descriptions go one per line, bare tags fit in one.
 	aliasesStr := strings.Join(aliases, " ")
-	contactsStr := strings.Join(bh.config.HelpContacts, " ")
+	if described {
+		aliasesStr = strings.Join(aliases, "\n")
+	}
+	if prefixes := ix.Prefixes(msg.Chat.ID); len(prefixes) > 1 {
+		aliasesStr += fmt.Sprintf("\nТеги можна починати з %s або %s.",
+			strings.Join(prefixes[:len(prefixes)-1], ", "), prefixes[len(prefixes)-1])
+	}
+	contactsStr := strings.Join(current.config.HelpContacts, " ")
 	newMsg := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf(`
 Щоб переслати повідомлення в інший UACT чат:
 
@@ -200,18 +302,79 @@ func (bh Handler) command(update tgbotapi.Update) {
 
 За поясненням до тегів і як працює пересилка, звертайтеся до %s
 	`, aliasesStr, contactsStr))
-	bh.bot.Send(newMsg)
+	bh.send(logger, newMsg)
 }
 
+// maxMessageLength is the longest text Telegram accepts in a message, in
+// UTF-16 code units.
+const maxMessageLength = 4096
+
+// tree posts the chat tree, split into several messages if it's too long.
+func (bh Handler) tree(logger *logging.Logger, msg *tgbotapi.Message, config Config) {
+	for _, text := range splitMessage(config.TextTree()) {
+		bh.send(logger, tgbotapi.NewMessage(msg.Chat.ID, text))
+	}
+}
+
+// splitMessage splits text into messages Telegram accepts, between lines
+// where it can and inside the lines longer than a message. Blank messages
+// are dropped.
+func splitMessage(text string) []string {
+	var messages []string
+	var b strings.Builder
+	length := 0
+	flush := func() {
+		if strings.TrimSpace(b.String()) != "" {
+			messages = append(messages, b.String())
+		}
+		b.Reset()
+		length = 0
+	}
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if length+len(utf16.Encode([]rune(line))) > maxMessageLength {
+			flush()
+		}
+		for _, r := range line {
+			n := len(utf16.Encode([]rune{r}))
+			if length+n > maxMessageLength {
+				flush()
+			}
+			b.WriteRune(r)
+			length += n
+		}
+	}
+	flush()
+	return messages
+}
+
+// AllowedUpdates are the update types the Handler handles. The webhook has
+// to be registered for exactly these.
+var AllowedUpdates = []string{"message", "inline_query", "chosen_inline_result", "callback_query"}
+
 func (bh Handler) HandleUpdate(update tgbotapi.Update) error {
+	kind := UpdateKind(update)
+	bh.metrics.UpdateReceived(kind)
+	defer func(start time.Time) {
+		bh.metrics.UpdateHandled(kind, time.Since(start))
+	}(time.Now())
+
+	logger := bh.logger.With("update_id", update.UpdateID, "update_type", kind)
+	if update.Message != nil && update.Message.Chat != nil {
+		logger = logger.With("chat_id", update.Message.Chat.ID, "message_id", update.Message.MessageID)
+	}
+
 	var err error
-	switch {
-	case update.InlineQuery != nil:
-		bh.inlineQuery(update)
-	case update.Message != nil && update.Message.IsCommand():
-		bh.command(update)
-	case update.Message != nil:
-		bh.message(update)
+	switch kind {
+	case UpdateKindInlineQuery:
+		bh.inlineQuery(logger, update)
+	case UpdateKindChosenInlineResult:
+		bh.chosenInlineResult(logger, update)
+	case UpdateKindCallbackQuery:
+		bh.callbackQuery(logger, update)
+	case UpdateKindCommand:
+		bh.command(logger, update)
+	case UpdateKindMessage:
+		bh.message(logger, update)
 	default:
 		err = errors.New("unknown type of message")
 	}
@@ -1,10 +1,18 @@
 package bot
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+	"unicode/utf16"
 
+	"github.com/DzyubSpirit/reTGanslatorBot/logging"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -12,33 +20,87 @@ import (
 
 var config = Config{
 	Chats: []Chat{
-		{ID: 1, Aliases: []string{"First", "All", "SingleDigit"},
+		{ID: 1, Aliases: NewAliases("First", "All", "SingleDigit"),
 			ChildChats: []Chat{
-				{ID: 10, Aliases: []string{"Tenth", "All", "DoubleDigit"},
-					ChildChats: []Chat{{ID: 100, Aliases: []string{"Hundreadth", "All", "TripleDigit"}}}},
-				{ID: 11, Aliases: []string{"Eleventh", "All", "DoubleDigit"}},
+				{ID: 10, Aliases: NewAliases("Tenth", "All", "DoubleDigit"),
+					ChildChats: []Chat{{ID: 100, Aliases: NewAliases("Hundreadth", "All", "TripleDigit")}}},
+				{ID: 11, Aliases: NewAliases("Eleventh", "All", "DoubleDigit")},
 			},
 		},
-		{ID: 2, Aliases: []string{"Second", "All", "SingleDigit"}},
+		{ID: 2, Aliases: NewAliases("Second", "All", "SingleDigit")},
 	},
 	HelpContacts: []string{"@Kyslytsya", "@Karas", "@Valera", "@Arestovich"},
 }
 
+// fakeBot records the calls of the Handler. It's safe for concurrent use, the
+// fields may be read once the Handler is done.
 type fakeBot struct {
+	mu           sync.Mutex
 	sentMessages []tgbotapi.Chattable
 	inlineConfig tgbotapi.InlineConfig
+	getChatCalls int
+	callbacks    []tgbotapi.CallbackConfig
+	// admins are the IDs of the administrators of each chat.
+	admins map[int64][]int
+	pins   []tgbotapi.PinChatMessageConfig
+	// sendErr fails every Send if set.
+	sendErr error
 }
 
+// Send numbers the sent messages from 1.
 func (fb *fakeBot) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
 	fb.sentMessages = append(fb.sentMessages, c)
-	return tgbotapi.Message{}, nil
+	if fb.sendErr != nil {
+		return tgbotapi.Message{}, fb.sendErr
+	}
+	return tgbotapi.Message{MessageID: len(fb.sentMessages)}, nil
+}
+
+func (fb *fakeBot) GetChatMember(config tgbotapi.ChatConfigWithUser) (tgbotapi.ChatMember, error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	for _, id := range fb.admins[config.ChatID] {
+		if id == config.UserID {
+			return tgbotapi.ChatMember{Status: "administrator"}, nil
+		}
+	}
+	return tgbotapi.ChatMember{Status: "member"}, nil
+}
+
+func (fb *fakeBot) PinChatMessage(config tgbotapi.PinChatMessageConfig) (tgbotapi.APIResponse, error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	fb.pins = append(fb.pins, config)
+	return tgbotapi.APIResponse{}, nil
 }
 
 func (fb *fakeBot) AnswerInlineQuery(config tgbotapi.InlineConfig) (tgbotapi.APIResponse, error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
 	fb.inlineConfig = config
 	return tgbotapi.APIResponse{}, nil
 }
 
+func (fb *fakeBot) AnswerCallbackQuery(config tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	fb.callbacks = append(fb.callbacks, config)
+	return tgbotapi.APIResponse{}, nil
+}
+
+// GetChat finds chats with negative IDs nowhere, and names the others "Chat ID".
+func (fb *fakeBot) GetChat(config tgbotapi.ChatConfig) (tgbotapi.Chat, error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	fb.getChatCalls++
+	if config.ChatID < 0 {
+		return tgbotapi.Chat{}, errors.New("Bad Request: chat not found")
+	}
+	return tgbotapi.Chat{ID: config.ChatID, Title: fmt.Sprintf("Chat %d", config.ChatID)}, nil
+}
+
 func TestTagResendsMessage(t *testing.T) {
 	for _, testCase := range []struct {
 		name         string
@@ -257,6 +319,25 @@ func TestReplyResendsBothMessages(t *testing.T) {
 	}
 }
 
+// reach is the description of the inline suggestion of every alias of config.
+var reach = map[string]string{
+	"All":         "→ Chat 1, Chat 2, Chat 10, Chat 11, Chat 100 (5 chats)",
+	"DoubleDigit": "→ Chat 10, Chat 11 (2 chats)",
+	"Eleventh":    "→ Chat 11 (1 chat)",
+	"First":       "→ Chat 1 (1 chat)",
+	"Hundreadth":  "→ Chat 100 (1 chat)",
+	"Second":      "→ Chat 2 (1 chat)",
+	"SingleDigit": "→ Chat 1, Chat 2 (2 chats)",
+	"Tenth":       "→ Chat 10 (1 chat)",
+	"TripleDigit": "→ Chat 100 (1 chat)",
+}
+
+func suggestion(draft, alias string) tgbotapi.InlineQueryResultArticle {
+	result := tgbotapi.NewInlineQueryResultArticle(resultID(draft+"*"+alias), "*"+alias, draft+"*"+alias)
+	result.Description = reach[alias]
+	return result
+}
+
 func TestInlineQueries(t *testing.T) {
 	for _, testCase := range []struct {
 		name        string
@@ -266,33 +347,33 @@ func TestInlineQueries(t *testing.T) {
 		{name: "Empty query suggests all tags",
 			query: "",
 			wantResults: []interface{}{
-				tgbotapi.NewInlineQueryResultArticle("*All", "*All", "*All"),
-				tgbotapi.NewInlineQueryResultArticle("*DoubleDigit", "*DoubleDigit", "*DoubleDigit"),
-				tgbotapi.NewInlineQueryResultArticle("*Eleventh", "*Eleventh", "*Eleventh"),
-				tgbotapi.NewInlineQueryResultArticle("*First", "*First", "*First"),
-				tgbotapi.NewInlineQueryResultArticle("*Hundreadth", "*Hundreadth", "*Hundreadth"),
-				tgbotapi.NewInlineQueryResultArticle("*Second", "*Second", "*Second"),
-				tgbotapi.NewInlineQueryResultArticle("*SingleDigit", "*SingleDigit", "*SingleDigit"),
-				tgbotapi.NewInlineQueryResultArticle("*Tenth", "*Tenth", "*Tenth"),
-				tgbotapi.NewInlineQueryResultArticle("*TripleDigit", "*TripleDigit", "*TripleDigit"),
+				suggestion("", "All"),
+				suggestion("", "DoubleDigit"),
+				suggestion("", "Eleventh"),
+				suggestion("", "First"),
+				suggestion("", "Hundreadth"),
+				suggestion("", "Second"),
+				suggestion("", "SingleDigit"),
+				suggestion("", "Tenth"),
+				suggestion("", "TripleDigit"),
 			}},
 		{name: "A star suggests all tags",
 			query: "*",
 			wantResults: []interface{}{
-				tgbotapi.NewInlineQueryResultArticle("*All", "*All", "*All"),
-				tgbotapi.NewInlineQueryResultArticle("*DoubleDigit", "*DoubleDigit", "*DoubleDigit"),
-				tgbotapi.NewInlineQueryResultArticle("*Eleventh", "*Eleventh", "*Eleventh"),
-				tgbotapi.NewInlineQueryResultArticle("*First", "*First", "*First"),
-				tgbotapi.NewInlineQueryResultArticle("*Hundreadth", "*Hundreadth", "*Hundreadth"),
-				tgbotapi.NewInlineQueryResultArticle("*Second", "*Second", "*Second"),
-				tgbotapi.NewInlineQueryResultArticle("*SingleDigit", "*SingleDigit", "*SingleDigit"),
-				tgbotapi.NewInlineQueryResultArticle("*Tenth", "*Tenth", "*Tenth"),
-				tgbotapi.NewInlineQueryResultArticle("*TripleDigit", "*TripleDigit", "*TripleDigit"),
+				suggestion("", "All"),
+				suggestion("", "DoubleDigit"),
+				suggestion("", "Eleventh"),
+				suggestion("", "First"),
+				suggestion("", "Hundreadth"),
+				suggestion("", "Second"),
+				suggestion("", "SingleDigit"),
+				suggestion("", "Tenth"),
+				suggestion("", "TripleDigit"),
 			}},
 		{name: "A star and a subword filters suggestions",
 			query: "*Se",
 			wantResults: []interface{}{
-				tgbotapi.NewInlineQueryResultArticle("*Second", "*Second", "*Second"),
+				suggestion("", "Second"),
 			}},
 		{name: "A subword without matches gives no suggestions",
 			query:       "*thi",
@@ -300,25 +381,25 @@ func TestInlineQueries(t *testing.T) {
 		{name: "A subword without star filters suggestions",
 			query: "Fir",
 			wantResults: []interface{}{
-				tgbotapi.NewInlineQueryResultArticle("*First", "*First", "*First"),
+				suggestion("", "First"),
 			}},
 		{name: "A subword with a different letter case still matches",
 			query: "sec",
 			wantResults: []interface{}{
-				tgbotapi.NewInlineQueryResultArticle("*Second", "*Second", "*Second"),
+				suggestion("", "Second"),
 			}},
 		{name: "A star after some text and some space suggests all tags",
 			query: "Some message *",
 			wantResults: []interface{}{
-				tgbotapi.NewInlineQueryResultArticle("Some message *All", "*All", "Some message *All"),
-				tgbotapi.NewInlineQueryResultArticle("Some message *DoubleDigit", "*DoubleDigit", "Some message *DoubleDigit"),
-				tgbotapi.NewInlineQueryResultArticle("Some message *Eleventh", "*Eleventh", "Some message *Eleventh"),
-				tgbotapi.NewInlineQueryResultArticle("Some message *First", "*First", "Some message *First"),
-				tgbotapi.NewInlineQueryResultArticle("Some message *Hundreadth", "*Hundreadth", "Some message *Hundreadth"),
-				tgbotapi.NewInlineQueryResultArticle("Some message *Second", "*Second", "Some message *Second"),
-				tgbotapi.NewInlineQueryResultArticle("Some message *SingleDigit", "*SingleDigit", "Some message *SingleDigit"),
-				tgbotapi.NewInlineQueryResultArticle("Some message *Tenth", "*Tenth", "Some message *Tenth"),
-				tgbotapi.NewInlineQueryResultArticle("Some message *TripleDigit", "*TripleDigit", "Some message *TripleDigit"),
+				suggestion("Some message ", "All"),
+				suggestion("Some message ", "DoubleDigit"),
+				suggestion("Some message ", "Eleventh"),
+				suggestion("Some message ", "First"),
+				suggestion("Some message ", "Hundreadth"),
+				suggestion("Some message ", "Second"),
+				suggestion("Some message ", "SingleDigit"),
+				suggestion("Some message ", "Tenth"),
+				suggestion("Some message ", "TripleDigit"),
 			}},
 		{name: "A star after some text immediately without any space doesn't suggest anything to not spam",
 			query:       "Some message*",
@@ -326,20 +407,66 @@ func TestInlineQueries(t *testing.T) {
 		{name: "A star after a tag and a space suggests all tags",
 			query: "*first *",
 			wantResults: []interface{}{
-				tgbotapi.NewInlineQueryResultArticle("*first *All", "*All", "*first *All"),
-				tgbotapi.NewInlineQueryResultArticle("*first *DoubleDigit", "*DoubleDigit", "*first *DoubleDigit"),
-				tgbotapi.NewInlineQueryResultArticle("*first *Eleventh", "*Eleventh", "*first *Eleventh"),
-				tgbotapi.NewInlineQueryResultArticle("*first *First", "*First", "*first *First"),
-				tgbotapi.NewInlineQueryResultArticle("*first *Hundreadth", "*Hundreadth", "*first *Hundreadth"),
-				tgbotapi.NewInlineQueryResultArticle("*first *Second", "*Second", "*first *Second"),
-				tgbotapi.NewInlineQueryResultArticle("*first *SingleDigit", "*SingleDigit", "*first *SingleDigit"),
-				tgbotapi.NewInlineQueryResultArticle("*first *Tenth", "*Tenth", "*first *Tenth"),
-				tgbotapi.NewInlineQueryResultArticle("*first *TripleDigit", "*TripleDigit", "*first *TripleDigit"),
+				suggestion("*first ", "All"),
+				suggestion("*first ", "DoubleDigit"),
+				suggestion("*first ", "Eleventh"),
+				suggestion("*first ", "First"),
+				suggestion("*first ", "Hundreadth"),
+				suggestion("*first ", "Second"),
+				suggestion("*first ", "SingleDigit"),
+				suggestion("*first ", "Tenth"),
+				suggestion("*first ", "TripleDigit"),
 			}},
 		{name: "A star and a subword after a tag and a space filters the tags",
 			query: "*first *a",
 			wantResults: []interface{}{
-				tgbotapi.NewInlineQueryResultArticle("*first *All", "*All", "*first *All"),
+				suggestion("*first ", "All"),
+				suggestion("*first ", "Hundreadth"),
+			}},
+		{name: "Word starts match",
+			query: "*digit",
+			wantResults: []interface{}{
+				suggestion("", "DoubleDigit"),
+				suggestion("", "SingleDigit"),
+				suggestion("", "TripleDigit"),
+			}},
+		{name: "Prefixes go before word starts and substrings",
+			query: "*d",
+			wantResults: []interface{}{
+				suggestion("", "DoubleDigit"),
+				suggestion("", "SingleDigit"),
+				suggestion("", "TripleDigit"),
+				suggestion("", "Hundreadth"),
+				suggestion("", "Second"),
+			}},
+		{name: "A typo still matches",
+			query: "*secnd",
+			wantResults: []interface{}{
+				suggestion("", "Second"),
+			}},
+		{name: "Short words don't match with typos",
+			query:       "*sed",
+			wantResults: nil},
+		{name: "Trailing spaces after a tag are ignored",
+			query: "*sec ",
+			wantResults: []interface{}{
+				suggestion("", "Second"),
+			}},
+		{name: "Trailing spaces after a word are ignored",
+			query: "a   ",
+			wantResults: []interface{}{
+				suggestion("", "All"),
+				suggestion("", "Hundreadth"),
+			}},
+		{name: "A trailing tab after a tag following some text is ignored",
+			query: "Some msg *firs\t",
+			wantResults: []interface{}{
+				suggestion("Some msg ", "First"),
+			}},
+		{name: "A trailing newline after a word following some text is ignored",
+			query: "Some msg sec\n",
+			wantResults: []interface{}{
+				suggestion("Some msg ", "Second"),
 			}},
 	} {
 		t.Run(testCase.name, func(t *testing.T) {
@@ -356,3 +483,433 @@ func TestInlineQueries(t *testing.T) {
 		})
 	}
 }
+
+func TestInlineResultsDescribeChats(t *testing.T) {
+	config := Config{Chats: []Chat{
+		{ID: 5, Title: "Asgard", Description: "Gods", Aliases: NewAliases("Asgard", "Realms")},
+		{ID: -6, Description: "Gone", Aliases: NewAliases("Lost", "Realms")},
+		{ID: 7, Description: "Gods", Aliases: NewAliases("Realms")},
+	}}
+	bot := &fakeBot{}
+	handler := NewHandler(config, bot)
+	query := func(text string) []interface{} {
+		handler.HandleUpdate(tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{Query: text}})
+		return bot.inlineConfig.Results
+	}
+
+	query("*realm")
+	results := query("*realm")
+
+	want := tgbotapi.NewInlineQueryResultArticle(resultID("*Realms"), "*Realms", "*Realms")
+	want.Description = "→ Asgard, chat -6, Chat 7 (3 chats)\nGods; Gone"
+	if diff := cmp.Diff([]interface{}{want}, results); diff != "" {
+		t.Errorf("Wrong inline results, cmp.Diff(want, got):\n%s", diff)
+	}
+	if bot.getChatCalls != 2 {
+		t.Errorf("Expected titles to be fetched once for chats without one, got %d getChat calls", bot.getChatCalls)
+	}
+
+	results = query(strings.Repeat("A long draft ", 10) + "*asg")
+	if id := results[0].(tgbotapi.InlineQueryResultArticle).ID; len(id) > 64 {
+		t.Errorf("Expected result IDs to fit 64 bytes, got %q", id)
+	}
+}
+
+func TestAliasMetadata(t *testing.T) {
+	config := Config{Chats: []Chat{
+		{ID: 1, Aliases: []Alias{{Name: "Asgard", Description: "Home of the gods"}, {Name: "Valhalla", Hidden: true}}},
+		{ID: 2, Aliases: []Alias{{Name: "Midgard"}, {Name: "Earth", DeprecatedBy: "Midgard"}}},
+	}}
+	bot := &fakeBot{}
+	handler := NewHandler(config, bot)
+
+	handler.HandleUpdate(tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{Query: "*"}})
+	var titles []string
+	for _, result := range bot.inlineConfig.Results {
+		titles = append(titles, result.(tgbotapi.InlineQueryResultArticle).Title)
+	}
+	if diff := cmp.Diff([]string{"*Asgard", "*Midgard"}, titles); diff != "" {
+		t.Errorf("Expected hidden and deprecated aliases not to be suggested, cmp.Diff(want, got):\n%s", diff)
+	}
+	if got := bot.inlineConfig.Results[0].(tgbotapi.InlineQueryResultArticle).Description; !strings.HasSuffix(got, "\nHome of the gods") {
+		t.Errorf("Expected the alias description in the result, got %q", got)
+	}
+
+	handler.HandleUpdate(tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 1}, From: &tgbotapi.User{}, MessageID: 42, Text: "Hi *earth and *valhalla",
+	}})
+	nudge := tgbotapi.NewMessage(1, "Тег *Earth застарів, використовуйте *Midgard.")
+	nudge.ReplyToMessageID = 42
+	// Hidden aliases still route.
+	if got := bot.sentMessages; len(got) != 5 || !cmp.Equal(got[4], nudge) {
+		t.Errorf("Expected the message delivered to chats 1 and 2 and a nudge to use *Midgard, got %+v", got)
+	}
+
+	bot.sentMessages = nil
+	handler.HandleUpdate(tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 1}, From: &tgbotapi.User{}, Text: "/help",
+		Entities: &[]tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: 5}},
+	}})
+	help := bot.sentMessages[0].(tgbotapi.MessageConfig).Text
+	if !strings.Contains(help, "\n*asgard — Home of the gods\n*midgard\n") || strings.Contains(help, "valhalla") {
+		t.Errorf("Expected /help to list suggested tags with descriptions one per line, got %q", help)
+	}
+}
+
+func TestInlineQueriesPreferRecentTags(t *testing.T) {
+	bot := &fakeBot{}
+	handler := NewHandler(config, bot)
+	user := &tgbotapi.User{ID: 7}
+	for _, text := range []string{"*tenth", "*SingleDigit and *eleventh"} {
+		handler.HandleUpdate(tgbotapi.Update{Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}, From: user, Text: text}})
+	}
+
+	handler.HandleUpdate(tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{From: user, Query: "*t"}})
+
+	var got []string
+	for _, result := range bot.inlineConfig.Results {
+		got = append(got, result.(tgbotapi.InlineQueryResultArticle).Title)
+	}
+	// Prefixes first, the recent ones of them first.
+	want := []string{"*Tenth", "*TripleDigit", "*SingleDigit", "*Eleventh", "*DoubleDigit", "*First", "*Hundreadth"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Wrong order of suggestions, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestInlineQueriesArePersonal(t *testing.T) {
+	bot := &fakeBot{}
+	handler := NewHandler(Config{Chats: []Chat{
+		{ID: 1, Aliases: NewAliases("First")},
+		{ID: 2, Aliases: NewAliases("Second")},
+		{ID: 3, Aliases: NewAliases("Announcements"), AcceptFrom: []string{"First"}},
+	}}, bot)
+	suggested := func(userID int) []string {
+		handler.HandleUpdate(tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{From: &tgbotapi.User{ID: userID}, Query: "*"}})
+		var titles []string
+		for _, result := range bot.inlineConfig.Results {
+			titles = append(titles, result.(tgbotapi.InlineQueryResultArticle).Title)
+		}
+		return titles
+	}
+	message := func(msg tgbotapi.Message) {
+		msg.Chat = &tgbotapi.Chat{ID: 2}
+		handler.HandleUpdate(tgbotapi.Update{Message: &msg})
+	}
+
+	if diff := cmp.Diff([]string{"*Announcements", "*First", "*Second"}, suggested(8)); diff != "" {
+		t.Errorf("Expected all tags for a user not seen in any chat, cmp.Diff(want, got):\n%s", diff)
+	}
+	if !bot.inlineConfig.IsPersonal || bot.inlineConfig.CacheTime != inlineCacheTime {
+		t.Errorf("Expected personal results cached for %ds, got %+v", inlineCacheTime, bot.inlineConfig)
+	}
+
+	message(tgbotapi.Message{From: &tgbotapi.User{ID: 8}, Text: "Hi"})
+	message(tgbotapi.Message{From: &tgbotapi.User{ID: 1}, NewChatMembers: &[]tgbotapi.User{{ID: 9}}})
+	for _, userID := range []int{8, 9} {
+		if diff := cmp.Diff([]string{"*First", "*Second"}, suggested(userID)); diff != "" {
+			t.Errorf("Expected user %d not to get tags of chats not accepting chat 2, cmp.Diff(want, got):\n%s", userID, diff)
+		}
+	}
+
+	message(tgbotapi.Message{From: &tgbotapi.User{ID: 8}, LeftChatMember: &tgbotapi.User{ID: 8}})
+	if diff := cmp.Diff([]string{"*Announcements", "*First", "*Second"}, suggested(8)); diff != "" {
+		t.Errorf("Expected all tags for a user who left, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestChosenInlineResultsAreRecent(t *testing.T) {
+	bot := &fakeBot{}
+	handler := NewHandler(config, bot)
+	user := &tgbotapi.User{ID: 7}
+
+	handler.HandleUpdate(tgbotapi.Update{ChosenInlineResult: &tgbotapi.ChosenInlineResult{
+		From: user, Query: "Hi *te", ResultID: resultID("Hi *Tenth"),
+	}})
+	// The query may end in whitespace the suggestion doesn't have.
+	handler.HandleUpdate(tgbotapi.Update{ChosenInlineResult: &tgbotapi.ChosenInlineResult{
+		From: user, Query: "Hi *elev \n", ResultID: resultID("Hi *Eleventh"),
+	}})
+	handler.HandleUpdate(tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{From: user, Query: "*"}})
+
+	var titles []string
+	for _, result := range bot.inlineConfig.Results[:2] {
+		titles = append(titles, result.(tgbotapi.InlineQueryResultArticle).Title)
+	}
+	if diff := cmp.Diff([]string{"*Eleventh", "*Tenth"}, titles); diff != "" {
+		t.Errorf("Expected the chosen tags to be suggested first, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestInlineQueriesArePaged(t *testing.T) {
+	config := largeConfig(120, 8)
+	aliases := len(config.AllAliases())
+	bot := &fakeBot{}
+	handler := NewHandler(config, bot)
+
+	var got []string
+	for offset := ""; ; offset = bot.inlineConfig.NextOffset {
+		handler.HandleUpdate(tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{Query: "*", Offset: offset}})
+		if n := len(bot.inlineConfig.Results); n > maxInlineResults {
+			t.Fatalf("Expected at most %d results at offset %q, got %d", maxInlineResults, offset, n)
+		}
+		for _, result := range bot.inlineConfig.Results {
+			got = append(got, strings.TrimPrefix(result.(tgbotapi.InlineQueryResultArticle).Title, "*"))
+		}
+		if bot.inlineConfig.NextOffset == "" {
+			break
+		}
+	}
+
+	if diff := cmp.Diff(config.AllAliases(), got); diff != "" {
+		t.Errorf("Expected all %d aliases over the pages, cmp.Diff(want, got):\n%s", aliases, diff)
+	}
+}
+
+type fakeMetrics struct {
+	NopMetrics
+	mu         sync.Mutex
+	tags       []string
+	deliveries [][2]int64
+}
+
+func (fm *fakeMetrics) TagMatched(alias string) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	fm.tags = append(fm.tags, alias)
+}
+
+func (fm *fakeMetrics) MessageDelivered(fromChatID, toChatID int64) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	fm.deliveries = append(fm.deliveries, [2]int64{fromChatID, toChatID})
+}
+
+func TestMetricsCountTagsAndDeliveries(t *testing.T) {
+	metrics := &fakeMetrics{}
+	handler := NewHandler(config, &fakeBot{}, WithMetrics(metrics))
+
+	handler.HandleUpdate(tgbotapi.Update{
+		Message: &tgbotapi.Message{
+			Chat:      &tgbotapi.Chat{ID: 1},
+			From:      &tgbotapi.User{},
+			MessageID: 42,
+			Text:      "My message *DoubleDigit",
+		},
+	})
+
+	if diff := cmp.Diff([]string{"DoubleDigit"}, metrics.tags); diff != "" {
+		t.Errorf("Wrong tags reported, cmp.Diff(want, got): %s", diff)
+	}
+	if diff := cmp.Diff([][2]int64{{1, 10}, {1, 11}}, metrics.deliveries); diff != "" {
+		t.Errorf("Wrong deliveries reported, cmp.Diff(want, got): %s", diff)
+	}
+}
+
+func TestMessageLogs(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	for _, testCase := range []struct {
+		name     string
+		logging  LoggingConfig
+		wantText bool
+	}{
+		{name: "Texts are redacted by default",
+			wantText: false},
+		{name: "Verbose payloads log texts",
+			logging:  LoggingConfig{VerbosePayloads: true},
+			wantText: true},
+		{name: "Verbose payloads expire",
+			logging:  LoggingConfig{VerbosePayloads: true, VerboseUntil: &past},
+			wantText: false},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			var out bytes.Buffer
+			cfg := config
+			cfg.Logging = testCase.logging
+			handler := NewHandler(cfg, &fakeBot{}, WithLogger(logging.New(&out, logging.LevelInfo)))
+
+			handler.HandleUpdate(tgbotapi.Update{
+				UpdateID: 777,
+				Message: &tgbotapi.Message{
+					Chat:      &tgbotapi.Chat{ID: 1},
+					From:      &tgbotapi.User{},
+					MessageID: 42,
+					Text:      "Secret plans *second",
+				},
+			})
+
+			logs := out.String()
+			if got := strings.Contains(logs, "Secret plans"); got != testCase.wantText {
+				t.Errorf("Logs contain the message text: %v, want %v. Logs:\n%s", got, testCase.wantText, logs)
+			}
+			for _, line := range strings.Split(strings.TrimSpace(logs), "\n") {
+				if !strings.Contains(line, `"update_id":777`) {
+					t.Errorf("Log line without the update ID: %s", line)
+				}
+			}
+		})
+	}
+}
+
+func TestMessagesWithoutSender(t *testing.T) {
+	bot := &fakeBot{}
+	handler := NewHandler(config, bot)
+
+	handler.HandleUpdate(tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 1}, MessageID: 42, Text: "From a channel *second",
+	}})
+
+	if got := len(bot.sentMessages); got != 2 {
+		t.Errorf("Expected a message without a sender to be delivered to chat 2, got %+v", bot.sentMessages)
+	}
+}
+
+func TestLogsHideTheBotToken(t *testing.T) {
+	var out bytes.Buffer
+	bot := &fakeBot{sendErr: &url.Error{Op: "Post", URL: "https://api.telegram.org/bot123456:SECRET-BOT-TOKEN/forwardMessage",
+		Err: errors.New("connection refused")}}
+	handler := NewHandler(config, bot, WithLogger(logging.New(&out, logging.LevelInfo)))
+
+	handler.HandleUpdate(tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 1}, From: &tgbotapi.User{}, MessageID: 42, Text: "*second",
+	}})
+
+	if logs := out.String(); strings.Contains(logs, "SECRET-BOT-TOKEN") || !strings.Contains(logs, "connection refused") {
+		t.Errorf("Expected send errors logged without the token, got:\n%s", logs)
+	}
+}
+
+func TestSetConfigSwapsRouting(t *testing.T) {
+	bot := &fakeBot{}
+	handler := NewHandler(config, bot)
+	copied := *handler
+	message := tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 1}, From: &tgbotapi.User{}, MessageID: 5, Text: "*third",
+	}}
+
+	handler.HandleUpdate(message)
+	if len(bot.sentMessages) != 0 {
+		t.Fatalf("Expected no messages for an unknown tag, got %v", bot.sentMessages)
+	}
+
+	newConfig := config
+	newConfig.Chats = append([]Chat{{ID: 3, Aliases: NewAliases("Third")}}, config.Chats...)
+	handler.SetConfig(newConfig)
+	copied.HandleUpdate(message)
+
+	want := tgbotapi.NewForward(3, 1, 5)
+	if len(bot.sentMessages) != 2 || bot.sentMessages[1] != want {
+		t.Errorf("Expected a forward with the new config, got %v", bot.sentMessages)
+	}
+	if got := copied.Config().Chats[0].ID; got != 3 {
+		t.Errorf("Expected copies of the Handler to see the new config, got chat %d first", got)
+	}
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	const n = 50
+	bot := &fakeBot{}
+	metrics := &fakeMetrics{}
+	handler := NewHandler(config, bot, WithMetrics(metrics))
+	// The other config routes *DoubleDigit the same way.
+	other := config
+	other.Chats = append([]Chat{{ID: 3, Aliases: NewAliases("Third")}}, config.Chats...)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(4)
+		go func(i int) {
+			defer wg.Done()
+			handler.HandleUpdate(tgbotapi.Update{UpdateID: i, Message: &tgbotapi.Message{
+				Chat: &tgbotapi.Chat{ID: 1}, From: &tgbotapi.User{}, MessageID: i, Text: "Hi *DoubleDigit",
+			}})
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			handler.HandleUpdate(tgbotapi.Update{UpdateID: i, InlineQuery: &tgbotapi.InlineQuery{ID: strconv.Itoa(i), Query: "dig"}})
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			handler.HandleUpdate(tgbotapi.Update{UpdateID: i, Message: &tgbotapi.Message{
+				Chat: &tgbotapi.Chat{ID: 2}, From: &tgbotapi.User{}, Text: "/help",
+				Entities: &[]tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: 5}},
+			}})
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				handler.SetConfig(other)
+			} else {
+				handler.SetConfig(config)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Every tagged message is announced and forwarded to chats 10 and 11, and
+	// every /help is answered.
+	if got, want := len(bot.sentMessages), n*2*2+n; got != want {
+		t.Errorf("Expected %d messages sent, got %d", want, got)
+	}
+	if got, want := len(metrics.deliveries), n*2; got != want {
+		t.Errorf("Expected %d deliveries reported, got %d", want, got)
+	}
+	if got, want := len(metrics.tags), n; got != want {
+		t.Errorf("Expected %d tags reported, got %d", want, got)
+	}
+}
+
+func TestTreeCommand(t *testing.T) {
+	tree := tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 1}, From: &tgbotapi.User{}, Text: "/tree",
+		Entities: &[]tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: 5}},
+	}}
+
+	bot := &fakeBot{}
+	NewHandler(config, bot).HandleUpdate(tree)
+	if len(bot.sentMessages) != 0 {
+		t.Errorf("Expected /tree to be off by default, got %v", bot.sentMessages)
+	}
+
+	treeConfig := config
+	treeConfig.TreeCommand = true
+	NewHandler(treeConfig, bot).HandleUpdate(tree)
+	want := tgbotapi.NewMessage(1, config.TextTree())
+	if len(bot.sentMessages) != 1 || !cmp.Equal(bot.sentMessages[0], want) {
+		t.Errorf("Expected the tree to be posted, got %v", bot.sentMessages)
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	utf16Length := func(s string) int { return len(utf16.Encode([]rune(s))) }
+	// Cyrillic letters take 2 bytes and 1 UTF-16 code unit, emoji take 4
+	// bytes and 2 code units.
+	line := strings.Repeat("ї", 99) + "\n"
+	lines := strings.Repeat(line, 50)
+	long := strings.Repeat("😀", maxMessageLength/2+10)
+
+	for _, testCase := range []struct {
+		name    string
+		text    string
+		wantLen []int
+	}{
+		{name: "short", text: "Чати\n", wantLen: []int{5}},
+		{name: "lines", text: lines, wantLen: []int{40 * 100, 10 * 100}},
+		{name: "long line", text: line + long + "\n" + line, wantLen: []int{100, maxMessageLength, 20 + 1 + 100}},
+		{name: "blank", text: "\n\n", wantLen: nil},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			messages := splitMessage(testCase.text)
+			var gotLen []int
+			for _, m := range messages {
+				gotLen = append(gotLen, utf16Length(m))
+			}
+			if diff := cmp.Diff(testCase.wantLen, gotLen); diff != "" {
+				t.Errorf("Wrong message lengths, cmp.Diff(want, got):\n%s", diff)
+			}
+			if got := strings.Join(messages, ""); strings.TrimSpace(testCase.text) != "" && got != testCase.text {
+				t.Errorf("Expected the messages to make up the text, got %q", got)
+			}
+		})
+	}
+}
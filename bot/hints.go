@@ -0,0 +1,305 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/logging"
+	"github.com/DzyubSpirit/reTGanslatorBot/store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// maxHints is how many aliases are suggested for an unknown tag.
+const maxHints = 3
+
+// retagPrefix starts the data of the buttons resending a message with a
+// suggested tag, the alias follows.
+const retagPrefix = "retag:"
+
+// hintTTL is how long the buttons under a hint resend the message. Older
+// hints are forgotten when another one is sent in the chat.
+const hintTTL = 48 * time.Hour
+
+// maxHintedMessages is how many messages hints were sent for are remembered
+// per chat, the oldest ones are forgotten first.
+const maxHintedMessages = 100
+
+// hintedMessage is what resending a message with a hinted tag needs. Telegram
+// gives the message a hint replies to with the button presses, but not the
+// message that one replies to, so it's remembered when the hint is sent.
+type hintedMessage struct {
+	HintID           int       `json:"hint_id"`
+	MessageID        int       `json:"message_id"`
+	ReplyToMessageID int       `json:"reply_to_message_id,omitempty"`
+	UserID           int       `json:"user_id"`
+	SentAt           time.Time `json:"sent_at"`
+}
+
+// hintedMessages remembers in the store the messages hints were sent for in
+// every chat, oldest first. The lock keeps concurrent hints in a chat from
+// losing each other.
+type hintedMessages struct {
+	mu    sync.Mutex
+	store store.Store
+}
+
+func hintedMessagesKey(chatID int64) string {
+	return fmt.Sprintf("hints/%d", chatID)
+}
+
+// get returns the message the hint hintID in the chat was sent for.
+func (hm *hintedMessages) get(chatID int64, hintID int) (hintedMessage, bool, error) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	var hinted []hintedMessage
+	if _, err := hm.store.Get(hintedMessagesKey(chatID), &hinted); err != nil {
+		return hintedMessage{}, false, err
+	}
+	for _, m := range hinted {
+		if m.HintID == hintID {
+			return m, true, nil
+		}
+	}
+	return hintedMessage{}, false, nil
+}
+
+// put remembers m and forgets the messages of the chat hinted longer than
+// hintTTL before now, or over maxHintedMessages.
+func (hm *hintedMessages) put(chatID int64, m hintedMessage, now time.Time) error {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	var old []hintedMessage
+	if _, err := hm.store.Get(hintedMessagesKey(chatID), &old); err != nil {
+		return err
+	}
+	hinted := make([]hintedMessage, 0, len(old)+1)
+	for _, o := range old {
+		if now.Sub(o.SentAt) <= hintTTL {
+			hinted = append(hinted, o)
+		}
+	}
+	hinted = append(hinted, m)
+	if len(hinted) > maxHintedMessages {
+		hinted = hinted[len(hinted)-maxHintedMessages:]
+	}
+	return hm.store.Put(hintedMessagesKey(chatID), hinted)
+}
+
+// delete forgets the message the hint hintID in the chat was sent for.
+func (hm *hintedMessages) delete(chatID int64, hintID int) error {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	var old []hintedMessage
+	if _, err := hm.store.Get(hintedMessagesKey(chatID), &old); err != nil {
+		return err
+	}
+	hinted := make([]hintedMessage, 0, len(old))
+	for _, m := range old {
+		if m.HintID != hintID {
+			hinted = append(hinted, m)
+		}
+	}
+	if len(hinted) == 0 {
+		return hm.store.Delete(hintedMessagesKey(chatID))
+	}
+	return hm.store.Put(hintedMessagesKey(chatID), hinted)
+}
+
+// unknownTag is a tag matching no alias.
+type unknownTag struct {
+	// token is the tag as it's typed, prefix is its prefix and word the
+	// rest without quotes.
+	token, prefix, word string
+}
+
+// unknownTags returns the tags in texts with any of prefixes that tag no
+// alias. A token glued to the word before it or followed by its prefix again,
+// like in *bold*, isn't a tag.
+func unknownTags(ix *Index, prefixes []string, texts ...string) []unknownTag {
+	var unknown []unknownTag
+	seen := make(map[string]bool)
+	for _, text := range texts {
+		for _, loc := range ix.tagToken.FindAllStringIndex(text, -1) {
+			if loc[0] > 0 {
+				if r, _ := utf8.DecodeLastRuneInString(text[:loc[0]]); unicode.IsLetter(r) || unicode.IsDigit(r) {
+					continue
+				}
+			}
+			token := text[loc[0]:loc[1]]
+			prefix, word := splitTag(prefixes, token)
+			if prefix == "" || strings.HasPrefix(text[loc[1]:], prefix) {
+				continue
+			}
+			key := strings.ToLower(token)
+			if seen[key] || len(ix.TaggedAliases(prefixes, TaggedText{Text: token})) > 0 {
+				continue
+			}
+			seen[key] = true
+			unknown = append(unknown, unknownTag{token: token, prefix: prefix, word: word})
+		}
+	}
+	return unknown
+}
+
+// closestAliases returns up to maxHints aliases spelled like word with a few
+// typos, the closest first.
+func closestAliases(ix *Index, word string) []string {
+	maxDistance := utf8.RuneCountInString(word) / 3
+	if maxDistance == 0 {
+		return nil
+	}
+	type hint struct {
+		alias    string
+		distance int
+	}
+	var hints []hint
+	for _, alias := range ix.SuggestedAliases() {
+		best := maxDistance + 1
+		for _, a := range aliasSpellings(strings.ToLower(alias)) {
+			for _, w := range textSpellings(strings.ToLower(word)) {
+				best = minInt(best, editDistance(spaceWords(w), spaceWords(a)))
+			}
+		}
+		if best <= maxDistance {
+			hints = append(hints, hint{alias: alias, distance: best})
+		}
+	}
+	sort.SliceStable(hints, func(i, j int) bool { return hints[i].distance < hints[j].distance })
+	var aliases []string
+	for i := 0; i < len(hints) && i < maxHints; i++ {
+		aliases = append(aliases, hints[i].alias)
+	}
+	return aliases
+}
+
+// hintUnknownTags replies to a message with tags matching no alias with the
+// aliases that were likely meant, and buttons to resend it with them.
+func (bh Handler) hintUnknownTags(logger *logging.Logger, current *snapshot, message *tgbotapi.Message) {
+	ix := current.router.Index()
+	node, ok := ix.Node(message.Chat.ID)
+	if !ok || node.Chat.SilenceUnknownTags {
+		return
+	}
+	var lines []string
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, tag := range unknownTags(ix, ix.Prefixes(message.Chat.ID), message.Text, message.Caption) {
+		aliases := closestAliases(ix, tag.word)
+		if len(aliases) == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("Тег %s не знайдено. Можливо, %s?", tag.token, joinTags(tag.prefix, aliases)))
+		var row []tgbotapi.InlineKeyboardButton
+		for _, alias := range aliases {
+			// Callback data is limited to 64 bytes.
+			if data := retagPrefix + alias; len(data) <= 64 {
+				row = append(row, tgbotapi.NewInlineKeyboardButtonData("Переслати в "+TagWith(tag.prefix, alias), data))
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	msg := tgbotapi.NewMessage(message.Chat.ID, strings.Join(lines, "\n"))
+	msg.ReplyToMessageID = message.MessageID
+	if len(rows) == 0 {
+		bh.send(logger, msg)
+		return
+	}
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	sent, err := bh.send(logger, msg)
+	if err != nil || message.From == nil {
+		return
+	}
+	now := time.Now()
+	hinted := hintedMessage{HintID: sent.MessageID, MessageID: message.MessageID, UserID: message.From.ID, SentAt: now}
+	if message.ReplyToMessage != nil {
+		hinted.ReplyToMessageID = message.ReplyToMessage.MessageID
+	}
+	if err := bh.hinted.put(message.Chat.ID, hinted, now); err != nil {
+		logger.Warn("Failed to remember the hinted message", "error", err)
+	}
+}
+
+// joinTags lists aliases as tags with prefix: "*a", "*a або *b", "*a, *b або
+// *c".
+func joinTags(prefix string, aliases []string) string {
+	tags := make([]string, len(aliases))
+	for i, alias := range aliases {
+		tags[i] = TagWith(prefix, alias)
+	}
+	if len(tags) == 1 {
+		return tags[0]
+	}
+	return strings.Join(tags[:len(tags)-1], ", ") + " або " + tags[len(tags)-1]
+}
+
+// callbackQuery handles the buttons under hints: the message the hint was
+// given for is resent with the chosen tag, together with the message it
+// replies to, if its author pressed the button.
+func (bh Handler) callbackQuery(logger *logging.Logger, update tgbotapi.Update) {
+	query := *update.CallbackQuery
+	answer := func(text string) {
+		if _, err := bh.bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, text)); err != nil {
+			bh.metrics.SendFailed(ErrorCode(err))
+			logger.Warn("Failed to answer callback query", "error", logging.RedactError(err))
+		}
+	}
+
+	hint := query.Message
+	if !strings.HasPrefix(query.Data, retagPrefix) || hint == nil {
+		answer("")
+		return
+	}
+	hinted, ok, err := bh.hinted.get(hint.Chat.ID, hint.MessageID)
+	if err != nil {
+		logger.Warn("Failed to read the hinted message", "error", err)
+	}
+	if !ok {
+		// The hint is older than hintTTL, was sent before the bot
+		// started remembering the messages, or the store was lost.
+		if hint.ReplyToMessage == nil || hint.ReplyToMessage.From == nil {
+			answer("")
+			return
+		}
+		hinted = hintedMessage{MessageID: hint.ReplyToMessage.MessageID, UserID: hint.ReplyToMessage.From.ID}
+	}
+	original := &tgbotapi.Message{Chat: hint.Chat, MessageID: hinted.MessageID}
+	if hinted.ReplyToMessageID != 0 {
+		original.ReplyToMessage = &tgbotapi.Message{Chat: hint.Chat, MessageID: hinted.ReplyToMessageID}
+	}
+	if query.From == nil || query.From.ID != hinted.UserID {
+		answer("Переслати повідомлення може лише його автор")
+		return
+	}
+
+	alias := strings.TrimPrefix(query.Data, retagPrefix)
+	current := bh.snapshot()
+	ix := current.router.Index()
+	tag := ix.ChatTag(original.Chat.ID, alias)
+	if len(ix.AliasChatIDs(alias)) == 0 {
+		answer(fmt.Sprintf("Тегу %s більше немає", tag))
+		return
+	}
+	plan := current.router.Route(original.Chat.ID, tag)
+	for _, a := range plan.Aliases {
+		bh.metrics.TagMatched(a)
+	}
+	if err := bh.recent.add(query.From.ID, alias); err != nil {
+		logger.Warn("Failed to remember the tags used", "error", err)
+	}
+	bh.deliver(logger, plan, original)
+	if err := bh.hinted.delete(hint.Chat.ID, hint.MessageID); err != nil {
+		logger.Warn("Failed to forget the hinted message", "error", err)
+	}
+
+	bh.send(logger, tgbotapi.NewEditMessageText(hint.Chat.ID, hint.MessageID, "Переслано з тегом "+tag))
+	answer("")
+}
@@ -0,0 +1,169 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUnknownTagsGetHints(t *testing.T) {
+	silenced := config
+	silenced.Chats = append([]Chat{{ID: 3, Aliases: NewAliases("Third"), SilenceUnknownTags: true}}, config.Chats...)
+
+	for _, testCase := range []struct {
+		name   string
+		chatID int64
+		text   string
+		want   []tgbotapi.Chattable
+	}{
+		{name: "A misspelled tag gets the closest aliases",
+			chatID: 1, text: "Meet at 6 *Secnod",
+			want: []tgbotapi.Chattable{func() tgbotapi.MessageConfig {
+				msg := tgbotapi.NewMessage(1, "Тег *Secnod не знайдено. Можливо, *Second?")
+				msg.ReplyToMessageID = 42
+				msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+					tgbotapi.NewInlineKeyboardButtonData("Переслати в *Second", "retag:Second")))
+				return msg
+			}()}},
+		{name: "Words unlike any alias get no hints",
+			chatID: 1, text: "*Important news"},
+		{name: "Emphasis isn't a tag",
+			chatID: 1, text: "*Secnod* a*Secnod"},
+		{name: "Chats may silence hints",
+			chatID: 3, text: "*Secnod"},
+		{name: "Messages from chats outside the config get no hints",
+			chatID: 5, text: "*Secnod"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			bot := &fakeBot{}
+			NewHandler(silenced, bot).HandleUpdate(tgbotapi.Update{Message: &tgbotapi.Message{
+				Chat: &tgbotapi.Chat{ID: testCase.chatID}, From: &tgbotapi.User{}, MessageID: 42, Text: testCase.text,
+			}})
+
+			if diff := cmp.Diff(testCase.want, bot.sentMessages); diff != "" {
+				t.Errorf("Wrong messages sent, cmp.Diff(want, got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJoinTags(t *testing.T) {
+	for aliases, want := range map[string]string{
+		"A":     "*A",
+		"A B":   "*A або *B",
+		"A B C": "*A, *B або *C",
+	} {
+		if got := joinTags("*", strings.Fields(aliases)); got != want {
+			t.Errorf("joinTags(%s) = %q, want %q", aliases, got, want)
+		}
+	}
+}
+
+func TestRetagButtonResendsMessage(t *testing.T) {
+	original := &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1, Title: "First chat"}, From: &tgbotapi.User{ID: 7},
+		MessageID: 42, Text: "*Secnod"}
+	press := func(bot *fakeBot, userID int) {
+		NewHandler(config, bot).HandleUpdate(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+			ID: "cb", From: &tgbotapi.User{ID: userID}, Data: "retag:Second",
+			Message: &tgbotapi.Message{Chat: original.Chat, MessageID: 43, ReplyToMessage: original},
+		}})
+	}
+
+	bot := &fakeBot{}
+	press(bot, 7)
+	want := []tgbotapi.Chattable{
+		tgbotapi.NewMessage(2, "Пересилаю повідомлення з чату First chat"),
+		tgbotapi.NewForward(2, 1, 42),
+		tgbotapi.NewEditMessageText(1, 43, "Переслано з тегом *Second"),
+	}
+	if diff := cmp.Diff(want, bot.sentMessages); diff != "" {
+		t.Errorf("Wrong messages sent, cmp.Diff(want, got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]tgbotapi.CallbackConfig{tgbotapi.NewCallback("cb", "")}, bot.callbacks); diff != "" {
+		t.Errorf("Wrong callback answers, cmp.Diff(want, got):\n%s", diff)
+	}
+
+	bot = &fakeBot{}
+	press(bot, 8)
+	if len(bot.sentMessages) != 0 {
+		t.Errorf("Expected only the author to resend, got %v", bot.sentMessages)
+	}
+	if diff := cmp.Diff([]tgbotapi.CallbackConfig{tgbotapi.NewCallback("cb", "Переслати повідомлення може лише його автор")}, bot.callbacks); diff != "" {
+		t.Errorf("Wrong callback answers, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestRetagButtonResendsTheReplyToo(t *testing.T) {
+	bot := &fakeBot{}
+	handler := NewHandler(config, bot)
+	chat := &tgbotapi.Chat{ID: 1, Title: "First chat"}
+	original := &tgbotapi.Message{Chat: chat, From: &tgbotapi.User{ID: 7}, MessageID: 42, Text: "*Secnod",
+		ReplyToMessage: &tgbotapi.Message{Chat: chat, MessageID: 41}}
+	handler.HandleUpdate(tgbotapi.Update{Message: original})
+	if len(bot.sentMessages) != 1 {
+		t.Fatalf("Expected a hint, got %v", bot.sentMessages)
+	}
+
+	// Telegram doesn't say what the message under the hint replies to.
+	bot.sentMessages = nil
+	handler.HandleUpdate(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID: "cb", From: &tgbotapi.User{ID: 7}, Data: "retag:Second",
+		Message: &tgbotapi.Message{Chat: chat, MessageID: 1, ReplyToMessage: &tgbotapi.Message{
+			Chat: chat, From: &tgbotapi.User{ID: 7}, MessageID: 42, Text: "*Secnod"}},
+	}})
+
+	want := []tgbotapi.Chattable{
+		tgbotapi.NewMessage(2, "Пересилаю повідомлення з чату First chat"),
+		tgbotapi.NewForward(2, 1, 41),
+		tgbotapi.NewForward(2, 1, 42),
+		tgbotapi.NewEditMessageText(1, 1, "Переслано з тегом *Second"),
+	}
+	if diff := cmp.Diff(want, bot.sentMessages); diff != "" {
+		t.Errorf("Wrong messages sent, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestHintedMessagesArePruned(t *testing.T) {
+	hinted := &hintedMessages{store: store.NewMemory()}
+	start := time.Date(2022, 8, 24, 12, 0, 0, 0, time.UTC)
+	put := func(chatID int64, hintID int, now time.Time) {
+		if err := hinted.put(chatID, hintedMessage{HintID: hintID, MessageID: hintID - 1, SentAt: now}, now); err != nil {
+			t.Fatalf("put failed: %v", err)
+		}
+	}
+	remembered := func(chatID int64, hintID int) bool {
+		_, ok, err := hinted.get(chatID, hintID)
+		if err != nil {
+			t.Fatalf("get failed: %v", err)
+		}
+		return ok
+	}
+
+	put(1, 2, start)
+	put(2, 2, start)
+	put(1, 4, start.Add(hintTTL+time.Minute))
+	if remembered(1, 2) {
+		t.Errorf("Expected a hint older than %v to be forgotten", hintTTL)
+	}
+	if !remembered(1, 4) || !remembered(2, 2) {
+		t.Errorf("Expected new hints and hints of other chats to be remembered")
+	}
+
+	for id := 10; id < 10+maxHintedMessages; id++ {
+		put(1, id, start.Add(hintTTL+time.Hour))
+	}
+	if remembered(1, 4) || !remembered(1, 10) {
+		t.Errorf("Expected only the last %d hints of a chat to be remembered", maxHintedMessages)
+	}
+
+	if err := hinted.delete(2, 2); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if remembered(2, 2) {
+		t.Errorf("Expected a deleted hint to be forgotten")
+	}
+}
@@ -0,0 +1,422 @@
+package bot
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Index is the config prepared for lookups on every update. It's built once
+// per config and never modified, so it's safe for concurrent use.
+type Index struct {
+	// chats are all chats in the order of Config.AllChats.
+	chats []Chat
+	// nodes maps chat IDs to their place in the tree.
+	nodes map[int64]IndexNode
+	// aliases are the distinct aliases sorted like Config.AllAliases.
+	aliases []string
+	// aliasChats maps lowercased aliases and group names to the positions of
+	// their chats in chats, ascending.
+	aliasChats map[string][]int
+	// chatGroups maps positions in chats to the names of the groups of the
+	// chat, in the order of Config.Groups.
+	chatGroups map[int][]string
+	// meta maps lowercased aliases to their metadata, merged from all chats
+	// having the alias.
+	meta map[string]Alias
+	// prefixes are the prefixes tags may start with, tagToken finds the
+	// words starting with them.
+	prefixes []string
+	tagToken *regexp.Regexp
+	// tags finds the tags of every spelling of the aliases with every
+	// prefix. tagAliases are the lowercased aliases spelled by each of its
+	// patterns and tagPrefixes the prefixes the patterns start with.
+	tags        *ahoCorasick
+	tagAliases  [][]string
+	tagPrefixes []string
+	// hashtags maps the spellings of the aliases, with spaces between words,
+	// to the lowercased aliases spelled so.
+	hashtags map[string][]string
+	// accepts maps IDs of chats with ACLs to the IDs of chats they accept
+	// messages from.
+	accepts map[int64]map[int64]bool
+}
+
+// IndexNode is a chat with its place in the chat tree.
+type IndexNode struct {
+	Chat Chat
+	// ParentID is the ID of the parent chat, 0 for top-level chats.
+	ParentID int64
+	// Position is the place of the chat in Config.AllChats.
+	Position int
+}
+
+// NewIndex builds the Index of config.
+func NewIndex(config Config) *Index {
+	ix := &Index{
+		nodes:      make(map[int64]IndexNode),
+		aliasChats: make(map[string][]int),
+		chatGroups: make(map[int][]string),
+		meta:       make(map[string]Alias),
+		accepts:    make(map[int64]map[int64]bool),
+		prefixes:   config.Prefixes(),
+		hashtags:   make(map[string][]string),
+	}
+	ix.tagToken = tagTokenRegexp(ix.prefixes)
+
+	type queued struct {
+		chat     Chat
+		parentID int64
+	}
+	var queue []queued
+	for _, chat := range config.Chats {
+		queue = append(queue, queued{chat: chat})
+	}
+	for len(queue) > 0 {
+		q := queue[0]
+		queue = queue[1:]
+
+		pos := len(ix.chats)
+		ix.chats = append(ix.chats, q.chat)
+		if _, ok := ix.nodes[q.chat.ID]; !ok {
+			ix.nodes[q.chat.ID] = IndexNode{Chat: q.chat, ParentID: q.parentID, Position: pos}
+		}
+		for _, alias := range q.chat.Aliases {
+			key := strings.ToLower(alias.Name)
+			positions := ix.aliasChats[key]
+			if len(positions) == 0 {
+				ix.aliases = append(ix.aliases, alias.Name)
+			}
+			ix.meta[key] = mergeAlias(ix.meta[key], alias)
+			if len(positions) == 0 || positions[len(positions)-1] != pos {
+				ix.aliasChats[key] = append(positions, pos)
+			}
+		}
+		for _, child := range q.chat.ChildChats {
+			queue = append(queue, queued{chat: child, parentID: q.chat.ID})
+		}
+	}
+
+	// Groups are tagged like aliases. A group named like an alias, which
+	// Validate reports, adds its chats to the alias.
+	groupIDs := config.GroupChatIDs()
+	for _, g := range config.Groups {
+		key := strings.ToLower(g.Name)
+		ids, ok := groupIDs[key]
+		if !ok {
+			continue
+		}
+		delete(groupIDs, key)
+		positions := ix.aliasChats[key]
+		if _, ok := ix.meta[key]; !ok {
+			ix.aliases = append(ix.aliases, g.Name)
+		}
+		ix.meta[key] = mergeAlias(ix.meta[key], g.Alias())
+		seen := make(map[int]bool)
+		for _, pos := range positions {
+			seen[pos] = true
+		}
+		for _, id := range ids {
+			pos := ix.nodes[id].Position
+			ix.chatGroups[pos] = append(ix.chatGroups[pos], g.Name)
+			if !seen[pos] {
+				seen[pos] = true
+				positions = append(positions, pos)
+			}
+		}
+		sort.Ints(positions)
+		ix.aliasChats[key] = positions
+	}
+
+	for _, chat := range ix.chats {
+		if len(chat.AcceptFrom) == 0 {
+			continue
+		}
+		sources := make(map[int64]bool)
+		for _, ref := range chat.AcceptFrom {
+			ids, _ := ix.ChatsByRef(ref)
+			for _, id := range ids {
+				sources[id] = true
+			}
+		}
+		ix.accepts[chat.ID] = sources
+	}
+
+	sort.Slice(ix.aliases, func(i, j int) bool {
+		return strings.ToLower(ix.aliases[i]) < strings.ToLower(ix.aliases[j])
+	})
+	var patterns []string
+	patternIndex := make(map[string]int)
+	for _, alias := range ix.aliases {
+		key := strings.ToLower(alias)
+		for _, spelling := range aliasSpellings(key) {
+			words := spaceWords(spelling)
+			ix.hashtags[words] = append(ix.hashtags[words], key)
+			for _, prefix := range ix.prefixes {
+				for _, pattern := range tagPatterns(prefix, spelling) {
+					i, ok := patternIndex[pattern]
+					if !ok {
+						i = len(patterns)
+						patternIndex[pattern] = i
+						patterns = append(patterns, pattern)
+						ix.tagAliases = append(ix.tagAliases, nil)
+						ix.tagPrefixes = append(ix.tagPrefixes, prefix)
+					}
+					ix.tagAliases[i] = append(ix.tagAliases[i], key)
+				}
+			}
+		}
+	}
+	ix.tags = newAhoCorasick(patterns)
+	return ix
+}
+
+// Chats returns all chats in the order of Config.AllChats. The slice must
+// not be modified.
+func (ix *Index) Chats() []Chat {
+	return ix.chats
+}
+
+// Node returns the chat with the given ID and its place in the tree.
+func (ix *Index) Node(chatID int64) (IndexNode, bool) {
+	node, ok := ix.nodes[chatID]
+	return node, ok
+}
+
+// Aliases returns the distinct aliases sorted like Config.AllAliases.
+func (ix *Index) Aliases() []string {
+	return append([]string(nil), ix.aliases...)
+}
+
+// Alias returns the metadata of the alias with the given name, in any case.
+func (ix *Index) Alias(name string) (Alias, bool) {
+	alias, ok := ix.meta[strings.ToLower(name)]
+	return alias, ok
+}
+
+// SuggestedAliases returns the aliases users should be offered, sorted like
+// Aliases: neither hidden nor deprecated.
+func (ix *Index) SuggestedAliases() []string {
+	var suggested []string
+	for _, name := range ix.aliases {
+		if ix.meta[strings.ToLower(name)].Suggested() {
+			suggested = append(suggested, name)
+		}
+	}
+	return suggested
+}
+
+// mergeAlias fills the metadata of an alias missing in merged from another
+// definition of the alias. The first definition wins.
+func mergeAlias(merged, alias Alias) Alias {
+	if merged.Name == "" {
+		return alias
+	}
+	if merged.Description == "" {
+		merged.Description = alias.Description
+	}
+	if merged.DeprecatedBy == "" {
+		merged.DeprecatedBy = alias.DeprecatedBy
+	}
+	merged.Hidden = merged.Hidden || alias.Hidden
+	return merged
+}
+
+// ChatAliases returns the aliases of the chat at position pos of Chats
+// followed by the names of its groups.
+func (ix *Index) ChatAliases(pos int) []string {
+	return append(ix.chats[pos].AliasNames(), ix.chatGroups[pos]...)
+}
+
+// AliasChatIDs returns the IDs of the chats having alias, or in the group
+// named so, in any case.
+func (ix *Index) AliasChatIDs(alias string) []int64 {
+	positions := ix.aliasChats[strings.ToLower(alias)]
+	ids := make([]int64, len(positions))
+	for i, pos := range positions {
+		ids[i] = ix.chats[pos].ID
+	}
+	return ids
+}
+
+// ChatsByRef returns the IDs of the chats a reference in Chat.AcceptFrom
+// stands for, with or without the leading "*": the chat with that ID, every
+// chat having that alias, or the chats of the group with that name. It
+// reports whether the reference names a chat, an alias or a group at all.
+func (ix *Index) ChatsByRef(ref string) ([]int64, bool) {
+	ref = strings.TrimPrefix(ref, "*")
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		if _, ok := ix.nodes[id]; ok {
+			return []int64{id}, true
+		}
+	}
+	if _, ok := ix.meta[strings.ToLower(ref)]; !ok {
+		return nil, false
+	}
+	return ix.AliasChatIDs(ref), true
+}
+
+// Accepts reports whether the chat chatID accepts messages forwarded from
+// the chat fromChatID: chats without AcceptFrom accept them from anywhere,
+// others only from the chats it refers to.
+func (ix *Index) Accepts(chatID, fromChatID int64) bool {
+	sources, ok := ix.accepts[chatID]
+	return !ok || sources[fromChatID]
+}
+
+// Prefixes returns the prefixes tags in the chat chatID may start with: those
+// the chat enables, or all of them.
+func (ix *Index) Prefixes(chatID int64) []string {
+	if node, ok := ix.nodes[chatID]; ok && len(node.Chat.TagPrefixes) > 0 {
+		return node.Chat.TagPrefixes
+	}
+	return ix.prefixes
+}
+
+// ChatTag returns how alias is tagged in the chat chatID, with the first
+// prefix the chat enables.
+func (ix *Index) ChatTag(chatID int64, alias string) string {
+	return TagWith(ix.Prefixes(chatID)[0], alias)
+}
+
+// TaggedAliases returns the lowercased aliases tagged in any of texts with
+// any of prefixes, case-insensitively, in one pass over every spelling of
+// every text: transliterated or with its tags typed in the other keyboard
+// layout. Known hashtags are looked up instead of the # tags in the text. The
+// aliases map to the modifiers typed after any of their tags.
+func (ix *Index) TaggedAliases(prefixes []string, texts ...TaggedText) map[string]Modifiers {
+	enabled := make(map[string]bool)
+	for _, prefix := range prefixes {
+		enabled[prefix] = true
+	}
+	tagged := make(map[string]Modifiers)
+	tag := func(alias string, m Modifiers) {
+		tagged[alias] = tagged[alias].merge(m)
+	}
+	for _, text := range texts {
+		lower := strings.ToLower(text.Text)
+		hashtagsKnown := text.Hashtags != nil && enabled[hashtagPrefix]
+		if hashtagsKnown {
+			for _, hashtag := range text.Hashtags {
+				hashtag = strings.ToLower(hashtag)
+				var m Modifiers
+				for rest, i := lower, 0; i >= 0; rest = rest[i+1:] {
+					if i = strings.Index(rest, hashtagPrefix+hashtag); i >= 0 {
+						m = m.merge(parseModifiers(rest[i+len(hashtagPrefix+hashtag):]))
+					}
+				}
+				for _, spelling := range textSpellings(hashtag) {
+					for _, alias := range ix.hashtags[spaceWords(spelling)] {
+						tag(alias, m)
+					}
+				}
+			}
+		}
+		if text.Text == "" {
+			continue
+		}
+		for _, spelling := range messageSpellings(lower, prefixes) {
+			ix.tags.match(spelling, func(pattern, end int) {
+				prefix := ix.tagPrefixes[pattern]
+				if !enabled[prefix] || hashtagsKnown && prefix == hashtagPrefix {
+					return
+				}
+				m := parseModifiers(spelling[end:])
+				for _, alias := range ix.tagAliases[pattern] {
+					tag(alias, m)
+				}
+			})
+		}
+	}
+	return tagged
+}
+
+// ahoCorasick finds all occurrences of a set of patterns in a single pass
+// over the bytes of a text.
+type ahoCorasick struct {
+	nodes []acNode
+}
+
+type acNode struct {
+	next map[byte]int32
+	fail int32
+	// pattern is the index of the pattern ending here, -1 if none.
+	pattern int32
+	// output is the nearest node on the fail chain ending a pattern, -1 if
+	// none.
+	output int32
+}
+
+func newAhoCorasick(patterns []string) *ahoCorasick {
+	ac := &ahoCorasick{nodes: []acNode{{next: make(map[byte]int32), pattern: -1, output: -1}}}
+	for i, p := range patterns {
+		var cur int32
+		for j := 0; j < len(p); j++ {
+			next, ok := ac.nodes[cur].next[p[j]]
+			if !ok {
+				next = int32(len(ac.nodes))
+				ac.nodes = append(ac.nodes, acNode{next: make(map[byte]int32), pattern: -1, output: -1})
+				ac.nodes[cur].next[p[j]] = next
+			}
+			cur = next
+		}
+		ac.nodes[cur].pattern = int32(i)
+	}
+
+	// Fail links by breadth-first search: the fail node of a node is the
+	// longest proper suffix of its path that is a path too.
+	queue := make([]int32, 0, len(ac.nodes))
+	for _, child := range ac.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for b, child := range ac.nodes[cur].next {
+			fail := ac.nodes[cur].fail
+			for {
+				if next, ok := ac.nodes[fail].next[b]; ok && next != child {
+					ac.nodes[child].fail = next
+					break
+				}
+				if fail == 0 {
+					break
+				}
+				fail = ac.nodes[fail].fail
+			}
+			failNode := ac.nodes[ac.nodes[child].fail]
+			if failNode.pattern >= 0 {
+				ac.nodes[child].output = ac.nodes[child].fail
+			} else {
+				ac.nodes[child].output = failNode.output
+			}
+			queue = append(queue, child)
+		}
+	}
+	return ac
+}
+
+// match calls found with the index of every pattern occurring in text and
+// where the occurrence ends, once per occurrence.
+func (ac *ahoCorasick) match(text string, found func(pattern, end int)) {
+	var cur int32
+	for i := 0; i < len(text); i++ {
+		for {
+			if next, ok := ac.nodes[cur].next[text[i]]; ok {
+				cur = next
+				break
+			}
+			if cur == 0 {
+				break
+			}
+			cur = ac.nodes[cur].fail
+		}
+		if p := ac.nodes[cur].pattern; p >= 0 {
+			found(int(p), i+1)
+		}
+		for out := ac.nodes[cur].output; out >= 0; out = ac.nodes[out].output {
+			found(int(ac.nodes[out].pattern), i+1)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package bot
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAhoCorasickFindsLikeContains(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randomString := func(n int) string {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = "ab*"[rnd.Intn(3)]
+		}
+		return string(b)
+	}
+
+	for round := 0; round < 200; round++ {
+		var patterns []string
+		seen := make(map[string]bool)
+		for i := 0; i < 1+rnd.Intn(8); i++ {
+			if p := randomString(1 + rnd.Intn(4)); !seen[p] {
+				seen[p] = true
+				patterns = append(patterns, p)
+			}
+		}
+		text := randomString(rnd.Intn(30))
+
+		found := make(map[int]bool)
+		newAhoCorasick(patterns).match(text, func(p, end int) {
+			if !strings.HasSuffix(text[:end], patterns[p]) {
+				t.Fatalf("Matching %q in %q: %q doesn't end at %d", patterns, text, patterns[p], end)
+			}
+			found[p] = true
+		})
+
+		for i, p := range patterns {
+			if want := strings.Contains(text, p); found[i] != want {
+				t.Fatalf("Matching %q in %q: found %q is %v, want %v", patterns, text, p, found[i], want)
+			}
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	ix := NewIndex(config)
+
+	if diff := cmp.Diff(config.AllAliases(), ix.Aliases()); diff != "" {
+		t.Errorf("Aliases differ from AllAliases, cmp.Diff(want, got):\n%s", diff)
+	}
+	if diff := cmp.Diff(config.AllChats(), ix.Chats()); diff != "" {
+		t.Errorf("Chats differ from AllChats, cmp.Diff(want, got):\n%s", diff)
+	}
+	if got := ix.AliasChatIDs("doubledigit"); !cmp.Equal(got, []int64{10, 11}) {
+		t.Errorf("AliasChatIDs(doubledigit) = %v, want [10 11]", got)
+	}
+	node, ok := ix.Node(100)
+	if !ok || node.ParentID != 10 || node.Chat.Aliases[0].Name != "Hundreadth" {
+		t.Errorf("Node(100) = %+v, %v; want the child of chat 10", node, ok)
+	}
+	if node, _ := ix.Node(1); node.ParentID != 0 {
+		t.Errorf("Expected top-level chats to have no parent, got %d", node.ParentID)
+	}
+	want := map[string]Modifiers{"second": {}, "tenth": {Pin: true, Silent: true}}
+	if got := ix.TaggedAliases([]string{"*"}, TaggedText{Text: "To *Second"}, TaggedText{Text: "and *TENTH~silent!PIN but not * first"}); !cmp.Equal(got, want) {
+		t.Errorf("TaggedAliases = %v, want %v", got, want)
+	}
+}
+
+// largeConfig has n chats in a tree of the given fan-out. Every chat has an
+// alias of its own, and every tenth chat shares a group alias.
+func largeConfig(n, fanOut int) Config {
+	chats := make([]Chat, n)
+	for i := range chats {
+		chats[i] = Chat{ID: int64(i + 1), Aliases: NewAliases(fmt.Sprintf("Chat%dX", i))}
+		if i%10 == 0 {
+			chats[i].Aliases = append(chats[i].Aliases, Alias{Name: fmt.Sprintf("Group%dY", i%(n/10+1))})
+		}
+	}
+	for i := n - 1; i > 0; i-- {
+		parent := (i - 1) / fanOut
+		chats[parent].ChildChats = append([]Chat{chats[i]}, chats[parent].ChildChats...)
+	}
+	return Config{Chats: chats[:1]}
+}
+
+var benchmarkText = strings.Repeat("Meeting notes, nothing to see here. ", 20) + "*chat4321x *group3y *unknown"
+
+// naiveRoute finds tagged chats the way the Handler did before the Index:
+// lowercasing and scanning the whole text for every alias of every chat.
+func naiveRoute(config Config, fromChatID int64, text string) []int64 {
+	known := false
+	for _, chat := range config.AllChats() {
+		if chat.ID == fromChatID {
+			known = true
+		}
+	}
+	if !known {
+		return nil
+	}
+	var ids []int64
+	for _, chat := range config.AllChats() {
+		for _, alias := range chat.AliasNames() {
+			if strings.Contains(strings.ToLower(text), "*"+strings.ToLower(alias)) {
+				ids = append(ids, chat.ID)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+func TestRouterMatchesNaiveRoute(t *testing.T) {
+	config := largeConfig(5000, 8)
+
+	got := NewRouter(config).Route(1, benchmarkText).ChatIDs()
+
+	if want := naiveRoute(config, 1, benchmarkText); !cmp.Equal(want, got) {
+		t.Errorf("Route = %v, naive routing = %v", got, want)
+	}
+}
+
+func BenchmarkNewIndex(b *testing.B) {
+	for _, n := range []int{100, 5000} {
+		config := largeConfig(n, 8)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				NewIndex(config)
+			}
+		})
+	}
+}
+
+func BenchmarkRoute(b *testing.B) {
+	for _, n := range []int{100, 5000} {
+		config := largeConfig(n, 8)
+		router := NewRouter(config)
+		b.Run(fmt.Sprintf("index/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				router.Route(1, benchmarkText)
+			}
+		})
+		b.Run(fmt.Sprintf("naive/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				naiveRoute(config, 1, benchmarkText)
+			}
+		})
+	}
+}
+
+func BenchmarkValidate(b *testing.B) {
+	for _, n := range []int{100, 5000} {
+		config := largeConfig(n, 8)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				config.Validate()
+			}
+		})
+	}
+}
+
+func BenchmarkDiffConfigs(b *testing.B) {
+	for _, n := range []int{100, 5000} {
+		config := largeConfig(n, 8)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				DiffConfigs(config, config)
+			}
+		})
+	}
+}
+
+func BenchmarkAliases(b *testing.B) {
+	config := largeConfig(5000, 8)
+	ix := NewIndex(config)
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ix.Aliases()
+		}
+	})
+	b.Run("AllAliases", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			config.AllAliases()
+		}
+	})
+}
@@ -0,0 +1,296 @@
+package bot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/logging"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// maxInlineResults is the most results Telegram accepts in one answer, the
+// rest are sent as the next pages.
+const maxInlineResults = 50
+
+// inlineCacheTime is how many seconds Telegram may reuse an answer to the
+// same query of the same user. Answers change as the user tags chats.
+const inlineCacheTime = 30
+
+// splitQuery splits an inline query into the draft typed so far and the last
+// word, which is being completed. A quoted tag with any of prefixes at the
+// end is the last word with its spaces, closed or not.
+func splitQuery(prefixes []string, query string) (draft, lastWord string) {
+	for _, prefix := range prefixes {
+		for _, q := range tagQuotes {
+			i := strings.LastIndex(query, prefix+q.open)
+			if i < 0 {
+				continue
+			}
+			rest := query[i+len(prefix)+len(q.open):]
+			if j := strings.Index(rest, q.close); j < 0 || isModifierSuffix(strings.TrimRightFunc(rest[j+len(q.close):], unicode.IsSpace)) {
+				return query[:i], strings.TrimRightFunc(query[i:], unicode.IsSpace)
+			}
+		}
+	}
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return query, ""
+	}
+	lastWord = words[len(words)-1]
+	trimmed := strings.TrimRightFunc(query, unicode.IsSpace)
+	return trimmed[:len(trimmed)-len(lastWord)], lastWord
+}
+
+// inlineQuery suggests the tags the user may use, the ones they used recently
+// first. A tag typed in full is suggested with modifiers too, and a tag
+// followed by modifiers only with them.
+func (bh Handler) inlineQuery(logger *logging.Logger, update tgbotapi.Update) {
+	query := *update.InlineQuery
+	current := bh.snapshot()
+	prefixes := current.router.Index().prefixes
+	withoutLastWord, lastWord := splitQuery(prefixes, query.Query)
+	lastTag, typedModifiers := splitModifiers(prefixes, lastWord)
+	prefix, word := queryTag(prefixes, lastTag)
+
+	var ranked []inlineSuggestion
+	// A prefix inside a word isn't a tag, suggesting tags there would be spam.
+	if !containsAny(word, prefixes) {
+		aliases := current.router.Index().SuggestedAliases()
+		var recent []string
+		if query.From != nil {
+			var err error
+			if recent, err = bh.recent.get(query.From.ID); err != nil {
+				logger.Warn("Failed to get the tags used recently", "error", err)
+			}
+			memberOf, err := bh.members.get(query.From.ID)
+			if err != nil {
+				logger.Warn("Failed to get the chats of the user", "error", err)
+			}
+			aliases = usableAliases(current.router.Index(), aliases, memberOf)
+		}
+		ranked = modifierSuggestions(rankAliases(aliases, word, recent), word, typedModifiers)
+	}
+
+	offset, _ := strconv.Atoi(query.Offset)
+	if offset < 0 || offset > len(ranked) {
+		offset = len(ranked)
+	}
+	page := ranked[offset:]
+	var nextOffset string
+	if len(page) > maxInlineResults {
+		page = page[:maxInlineResults]
+		nextOffset = strconv.Itoa(offset + maxInlineResults)
+	}
+
+	var results []interface{}
+	for _, s := range page {
+		results = append(results, bh.inlineResult(logger, current, withoutLastWord, prefix, s))
+	}
+	inlineConfig := tgbotapi.InlineConfig{
+		InlineQueryID: query.ID,
+		Results:       results,
+		CacheTime:     inlineCacheTime,
+		IsPersonal:    true,
+		NextOffset:    nextOffset,
+	}
+	if _, err := bh.bot.AnswerInlineQuery(inlineConfig); err != nil {
+		bh.metrics.SendFailed(ErrorCode(err))
+		logger.Warn("Failed to answer inline query", "error", logging.RedactError(err))
+	}
+}
+
+// chosenInlineResult remembers the tag the user picked from the suggestions
+// as used recently. Results are identified by hashes, so the tag is found by
+// hashing the suggestions again.
+func (bh Handler) chosenInlineResult(logger *logging.Logger, update tgbotapi.Update) {
+	chosen := *update.ChosenInlineResult
+	if chosen.From == nil {
+		return
+	}
+	ix := bh.snapshot().router.Index()
+	draft, lastWord := splitQuery(ix.prefixes, chosen.Query)
+	lastTag, typedModifiers := splitModifiers(ix.prefixes, lastWord)
+	prefix, _ := queryTag(ix.prefixes, lastTag)
+	modifiers := append([]string{""}, modifierCompletions(typedModifiers)...)
+	for _, alias := range ix.Aliases() {
+		for _, m := range modifiers {
+			if resultID(draft+TagWith(prefix, alias)+m) != chosen.ResultID {
+				continue
+			}
+			if err := bh.recent.add(chosen.From.ID, alias); err != nil {
+				logger.Warn("Failed to remember the tags used", "error", err)
+			}
+			return
+		}
+	}
+	logger.Debug("Chosen inline result matches no alias", "result_id", chosen.ResultID)
+}
+
+// queryTag splits the last word of an inline query into the prefix of the
+// tag being typed and the rest. Words without a prefix are completed with the
+// first one.
+func queryTag(prefixes []string, lastWord string) (prefix, word string) {
+	prefix, word = splitTag(prefixes, lastWord)
+	if prefix == "" {
+		prefix = prefixes[0]
+	}
+	return prefix, word
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// inlineSuggestion is an alias suggested with the modifiers to type after
+// its tag, if any.
+type inlineSuggestion struct {
+	alias     string
+	modifiers string
+}
+
+// modifierSuggestions suggests the ranked aliases for the word being typed.
+// If the word names the best one exactly, its tag is suggested with every
+// modifier right after it. If modifiers are being typed after the word, only
+// their completions are suggested.
+func modifierSuggestions(ranked []string, word, typedModifiers string) []inlineSuggestion {
+	exact := len(ranked) > 0 && word != ""
+	if exact {
+		score, _ := matchScore(ranked[0], word)
+		exact = score == matchExact
+	}
+	if typedModifiers != "" {
+		if !exact {
+			return nil
+		}
+		var suggestions []inlineSuggestion
+		for _, m := range modifierCompletions(typedModifiers) {
+			suggestions = append(suggestions, inlineSuggestion{alias: ranked[0], modifiers: m})
+		}
+		return suggestions
+	}
+	var suggestions []inlineSuggestion
+	for i, alias := range ranked {
+		suggestions = append(suggestions, inlineSuggestion{alias: alias})
+		if i == 0 && exact {
+			for _, m := range modifierCompletions("") {
+				suggestions = append(suggestions, inlineSuggestion{alias: alias, modifiers: m})
+			}
+		}
+	}
+	return suggestions
+}
+
+// inlineResult suggests completing the draft with the tag of the suggested
+// alias with prefix. The description says which chats the tag reaches, what
+// the modifiers do and what the tag or the chats are about.
+func (bh Handler) inlineResult(logger *logging.Logger, current *snapshot, draft, prefix string, s inlineSuggestion) tgbotapi.InlineQueryResultArticle {
+	alias := s.alias
+	tag := TagWith(prefix, alias) + s.modifiers
+	suggestion := draft + tag
+	result := tgbotapi.NewInlineQueryResultArticle(resultID(suggestion), tag, suggestion)
+
+	ix := current.router.Index()
+	var titles, descriptions []string
+	seen := make(map[string]bool)
+	for _, id := range ix.AliasChatIDs(alias) {
+		node, _ := ix.Node(id)
+		titles = append(titles, bh.chatTitle(logger, node.Chat))
+		if d := node.Chat.Description; d != "" && !seen[d] {
+			seen[d] = true
+			descriptions = append(descriptions, d)
+		}
+	}
+	chats := "chats"
+	if len(titles) == 1 {
+		chats = "chat"
+	}
+	result.Description = fmt.Sprintf("→ %s (%d %s)", strings.Join(titles, ", "), len(titles), chats)
+	if s.modifiers != "" {
+		result.Description += "\n" + DescribeModifiers(parseModifiers(s.modifiers))
+	}
+	// The description of the alias tells more than those of its chats.
+	if meta, _ := ix.Alias(alias); meta.Description != "" {
+		result.Description += "\n" + meta.Description
+	} else if len(descriptions) > 0 {
+		result.Description += "\n" + strings.Join(descriptions, "; ")
+	}
+	return result
+}
+
+// resultID identifies an inline result by a hash of its text, which may be
+// longer than the 64 bytes Telegram allows for IDs.
+func resultID(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:8])
+}
+
+// chatTitle names the chat by its title in the config, or by the one
+// Telegram knows if the config has none.
+func (bh Handler) chatTitle(logger *logging.Logger, chat Chat) string {
+	if chat.Title != "" {
+		return chat.Title
+	}
+	title, ok := bh.titles.get(chat.ID, time.Now())
+	if !ok {
+		tgChat, err := bh.bot.GetChat(tgbotapi.ChatConfig{ChatID: chat.ID})
+		if err != nil {
+			bh.metrics.SendFailed(ErrorCode(err))
+			logger.Warn("Failed to get chat", "to_chat_id", chat.ID, "error", logging.RedactError(err))
+		}
+		title = tgChat.Title
+		bh.titles.put(chat.ID, title, time.Now())
+	}
+	if title == "" {
+		return fmt.Sprintf("chat %d", chat.ID)
+	}
+	return title
+}
+
+// titleTTL is how long the titles fetched with getChat are used before
+// they're fetched again. Failures are remembered as empty titles, so that a
+// chat the bot isn't in doesn't cost a request on every inline query.
+const titleTTL = time.Hour
+
+// titleCache keeps the chat titles fetched from Telegram. It's shared by
+// copies of the Handler and outlives config changes, titles don't depend on
+// the config.
+type titleCache struct {
+	mu     sync.Mutex
+	titles map[int64]cachedTitle
+}
+
+type cachedTitle struct {
+	title   string
+	fetched time.Time
+}
+
+func newTitleCache() *titleCache {
+	return &titleCache{titles: make(map[int64]cachedTitle)}
+}
+
+func (c *titleCache) get(chatID int64, now time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.titles[chatID]
+	if !ok || now.Sub(cached.fetched) > titleTTL {
+		return "", false
+	}
+	return cached.title, true
+}
+
+func (c *titleCache) put(chatID int64, title string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.titles[chatID] = cachedTitle{title: title, fetched: now}
+}
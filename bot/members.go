@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// memberships remembers in the store which chats of the config every user is
+// in, as far as the bot has seen: the user posted there or joined. The lock
+// keeps concurrent updates of the same user from losing each other's chats.
+type memberships struct {
+	mu    sync.Mutex
+	store store.Store
+}
+
+func membershipsKey(userID int) string {
+	return fmt.Sprintf("chats/%d", userID)
+}
+
+// get returns the IDs of the chats the user is known to be in.
+func (m *memberships) get(userID int) ([]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var chats []int64
+	_, err := m.store.Get(membershipsKey(userID), &chats)
+	return chats, err
+}
+
+// set records whether the user is in the chat. The store is only written if
+// that's news.
+func (m *memberships) set(userID int, chatID int64, member bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var chats []int64
+	if _, err := m.store.Get(membershipsKey(userID), &chats); err != nil {
+		return err
+	}
+	if containsInt64(chats, chatID) == member {
+		return nil
+	}
+	updated := make([]int64, 0, len(chats)+1)
+	for _, id := range chats {
+		if id != chatID {
+			updated = append(updated, id)
+		}
+	}
+	if member {
+		updated = append(updated, chatID)
+	}
+	return m.store.Put(membershipsKey(userID), updated)
+}
+
+func containsInt64(list []int64, x int64) bool {
+	for _, item := range list {
+		if item == x {
+			return true
+		}
+	}
+	return false
+}
+
+// trackMembers records the membership changes a message in a chat of the
+// config shows: its sender, the users who joined and the one who left.
+func (bh Handler) trackMembers(current *snapshot, msg *tgbotapi.Message) error {
+	if _, ok := current.router.Index().Node(msg.Chat.ID); !ok {
+		return nil
+	}
+	if msg.From != nil && (msg.LeftChatMember == nil || msg.LeftChatMember.ID != msg.From.ID) {
+		if err := bh.members.set(msg.From.ID, msg.Chat.ID, true); err != nil {
+			return err
+		}
+	}
+	if msg.NewChatMembers != nil {
+		for _, user := range *msg.NewChatMembers {
+			if err := bh.members.set(user.ID, msg.Chat.ID, true); err != nil {
+				return err
+			}
+		}
+	}
+	if msg.LeftChatMember != nil {
+		return bh.members.set(msg.LeftChatMember.ID, msg.Chat.ID, false)
+	}
+	return nil
+}
+
+// usableAliases keeps the aliases the user can tag in some chat they're in:
+// aliases of chats that accept messages from one of those chats. Users the
+// bot hasn't seen in any chat yet may use all aliases.
+func usableAliases(ix *Index, aliases []string, memberOf []int64) []string {
+	var sources []int64
+	for _, id := range memberOf {
+		if _, ok := ix.Node(id); ok {
+			sources = append(sources, id)
+		}
+	}
+	if len(sources) == 0 {
+		return aliases
+	}
+	var usable []string
+	for _, alias := range aliases {
+		if reachable(ix, alias, sources) {
+			usable = append(usable, alias)
+		}
+	}
+	return usable
+}
+
+func reachable(ix *Index, alias string, sources []int64) bool {
+	for _, chatID := range ix.AliasChatIDs(alias) {
+		for _, from := range sources {
+			if ix.Accepts(chatID, from) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Metrics receives instrumentation events from the Handler. It keeps the bot
+// package independent of any particular metrics backend. Implementations have
+// to be safe for concurrent use.
+type Metrics interface {
+	// UpdateReceived counts an incoming update of the given kind.
+	UpdateReceived(kind string)
+	// TagMatched counts an alias found in a message from a configured chat.
+	TagMatched(alias string)
+	// MessageDelivered counts a message forwarded between two chats.
+	MessageDelivered(fromChatID, toChatID int64)
+	// SendFailed counts a failed Bot API call by its Telegram error code.
+	SendFailed(code string)
+	// UpdateHandled observes how long handling an update of the given kind took.
+	UpdateHandled(kind string, duration time.Duration)
+}
+
+// NopMetrics discards all events. It's used when no Metrics are configured.
+type NopMetrics struct{}
+
+func (NopMetrics) UpdateReceived(string)               {}
+func (NopMetrics) TagMatched(string)                   {}
+func (NopMetrics) MessageDelivered(int64, int64)       {}
+func (NopMetrics) SendFailed(string)                   {}
+func (NopMetrics) UpdateHandled(string, time.Duration) {}
+
+// Update kinds reported to Metrics.
+const (
+	UpdateKindInlineQuery        = "inline_query"
+	UpdateKindChosenInlineResult = "chosen_inline_result"
+	UpdateKindCallbackQuery      = "callback_query"
+	UpdateKindCommand            = "command"
+	UpdateKindMessage            = "message"
+	UpdateKindUnknown            = "unknown"
+)
+
+// UpdateKind classifies an update the same way HandleUpdate dispatches it.
+func UpdateKind(update tgbotapi.Update) string {
+	switch {
+	case update.InlineQuery != nil:
+		return UpdateKindInlineQuery
+	case update.ChosenInlineResult != nil:
+		return UpdateKindChosenInlineResult
+	case update.CallbackQuery != nil:
+		return UpdateKindCallbackQuery
+	case update.Message != nil && update.Message.IsCommand():
+		return UpdateKindCommand
+	case update.Message != nil:
+		return UpdateKindMessage
+	default:
+		return UpdateKindUnknown
+	}
+}
+
+// telegramErrorCodes maps the description prefixes of Bot API errors to their
+// HTTP-like error codes, because tgbotapi.Error doesn't keep the code itself.
+var telegramErrorCodes = map[string]int{
+	"Bad Request":       400,
+	"Unauthorized":      401,
+	"Forbidden":         403,
+	"Not Found":         404,
+	"Conflict":          409,
+	"Too Many Requests": 429,
+}
+
+// ErrorCode returns the Telegram error code of a failed Bot API call, "network"
+// if the call didn't reach Telegram and "unknown" if the code can't be told.
+func ErrorCode(err error) string {
+	var apiErr tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		return "network"
+	}
+	if apiErr.RetryAfter != 0 {
+		return "429"
+	}
+	for prefix, code := range telegramErrorCodes {
+		if strings.HasPrefix(apiErr.Message, prefix) {
+			return strconv.Itoa(code)
+		}
+	}
+	return "unknown"
+}
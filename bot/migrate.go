@@ -0,0 +1,271 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentConfigVersion is the config schema version this bot reads natively.
+// Documents without a version field are version 1.
+const CurrentConfigVersion = 2
+
+// migration upgrades a generic config document from one version to the next.
+type migration struct {
+	description string
+	migrate     func(doc map[string]interface{}) error
+}
+
+// migrations maps a version to the migration that upgrades documents of that
+// version to the next one. Only a change that makes valid configs of the
+// current version invalid or read differently bumps CurrentConfigVersion and
+// registers how to upgrade them here; new optional fields don't.
+var migrations = map[int]migration{
+	1: {
+		description: "start versioning the config",
+		migrate:     func(doc map[string]interface{}) error { return nil },
+	},
+}
+
+// configVersion returns the version of a generic document.
+func configVersion(doc map[string]interface{}) (int, error) {
+	v, ok := doc["version"]
+	if !ok {
+		return 1, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("version has to be an integer, got %s", describeJSON(v))
+	}
+	version, err := n.Int64()
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("version has to be a positive integer, got %s", n)
+	}
+	return int(version), nil
+}
+
+// migrateDocument upgrades doc in place to CurrentConfigVersion and returns
+// the version it had.
+func migrateDocument(doc map[string]interface{}) (int, error) {
+	from, err := configVersion(doc)
+	if err != nil {
+		return 0, err
+	}
+	if from > CurrentConfigVersion {
+		return from, fmt.Errorf("config version %d is newer than the supported version %d", from, CurrentConfigVersion)
+	}
+	for v := from; v < CurrentConfigVersion; v++ {
+		m, ok := migrations[v]
+		if !ok {
+			return from, fmt.Errorf("no migration from config version %d", v)
+		}
+		if err := m.migrate(doc); err != nil {
+			return from, fmt.Errorf("migrate config from version %d (%s): %w", v, m.description, err)
+		}
+		doc["version"] = json.Number(fmt.Sprint(v + 1))
+	}
+	return from, nil
+}
+
+// MigrateConfig upgrades a config to CurrentConfigVersion. It returns the
+// rewritten document in the same format with fields in the order of the
+// Config type, and the version the document had. YAML documents keep their
+// order and comments instead, only their version changes.
+func MigrateConfig(data []byte, format Format) ([]byte, int, error) {
+	doc, err := DecodeDocument(data, format)
+	if err != nil {
+		return nil, 0, err
+	}
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, 0, fmt.Errorf("expected an object, got %s", describeJSON(doc))
+	}
+	from, err := migrateDocument(obj)
+	if err != nil {
+		return nil, from, err
+	}
+	if format == FormatYAML {
+		migrated, err := migrateYAML(data, obj)
+		return migrated, from, err
+	}
+	migrated, err := encodeDocument(obj, format)
+	return migrated, from, err
+}
+
+// migrateYAML writes the version of the migrated document into the YAML
+// config it was decoded from. Migrations changing more than the version would
+// lose the comments, so they're refused.
+func migrateYAML(data []byte, migrated map[string]interface{}) ([]byte, error) {
+	doc, err := DecodeDocument(data, FormatYAML)
+	if err != nil {
+		return nil, err
+	}
+	if !reflect.DeepEqual(withoutVersion(doc.(map[string]interface{})), withoutVersion(migrated)) {
+		return nil, errors.New("the migration changes more than the version of the YAML config, " +
+			"which would lose its comments; convert the config to JSON and migrate that")
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	mapping := root.Content[0]
+	version := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: fmt.Sprint(migrated["version"])}
+	found := false
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == "version" {
+			version.LineComment = mapping.Content[i+1].LineComment
+			mapping.Content[i+1] = version
+			found = true
+		}
+	}
+	if !found {
+		// The version goes first, like in Config, taking over the comment
+		// above the document.
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+		if len(mapping.Content) > 0 {
+			key.HeadComment, mapping.Content[0].HeadComment = mapping.Content[0].HeadComment, ""
+		}
+		mapping.Content = append([]*yaml.Node{key, version}, mapping.Content...)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// withoutVersion returns a shallow copy of a document without its version.
+func withoutVersion(doc map[string]interface{}) map[string]interface{} {
+	rest := make(map[string]interface{}, len(doc))
+	for key, value := range doc {
+		if key != "version" {
+			rest[key] = value
+		}
+	}
+	return rest
+}
+
+// writeOrdered writes a generic document as indented JSON with object keys
+// in the order of the fields of t. Keys unknown to t go last, sorted.
+func writeOrdered(buf *bytes.Buffer, t reflect.Type, v interface{}, indent string) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := orderedKeys(t, v)
+		if len(keys) == 0 {
+			buf.WriteString("{}")
+			return
+		}
+		buf.WriteString("{\n")
+		for i, key := range keys {
+			buf.WriteString(indent + "  ")
+			raw, _ := json.Marshal(key)
+			buf.Write(raw)
+			buf.WriteString(": ")
+			writeOrdered(buf, fieldType(t, key), v[key], indent+"  ")
+			if i < len(keys)-1 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(indent + "}")
+	case []interface{}:
+		if len(v) == 0 {
+			buf.WriteString("[]")
+			return
+		}
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		if isScalarList(v) {
+			buf.WriteByte('[')
+			for i, item := range v {
+				if i > 0 {
+					buf.WriteString(", ")
+				}
+				raw, _ := json.Marshal(item)
+				buf.Write(raw)
+			}
+			buf.WriteByte(']')
+			return
+		}
+		buf.WriteString("[\n")
+		for i, item := range v {
+			buf.WriteString(indent + "  ")
+			writeOrdered(buf, elem, item, indent+"  ")
+			if i < len(v)-1 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(indent + "]")
+	default:
+		raw, _ := json.Marshal(v)
+		buf.Write(raw)
+	}
+}
+
+func isScalarList(v []interface{}) bool {
+	for _, item := range v {
+		switch item.(type) {
+		case map[string]interface{}, []interface{}:
+			return false
+		}
+	}
+	return true
+}
+
+func orderedKeys(t reflect.Type, obj map[string]interface{}) []string {
+	rank := make(map[string]int)
+	if t != nil && t.Kind() == reflect.Struct {
+		for name, f := range jsonFields(t) {
+			rank[name] = f.Index[0]
+		}
+	}
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ri, iKnown := rank[keys[i]]
+		rj, jKnown := rank[keys[j]]
+		if iKnown != jKnown {
+			return iKnown
+		}
+		if iKnown {
+			return ri < rj
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+func fieldType(t reflect.Type, key string) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if f, ok := jsonFields(t)[key]; ok {
+			return f.Type
+		}
+	case reflect.Map:
+		return t.Elem()
+	}
+	return nil
+}
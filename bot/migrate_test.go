@@ -0,0 +1,138 @@
+package bot
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMigrateConfig(t *testing.T) {
+	data := `{"help_contacts": ["@Karas"], "chats": [{"child_chats": [], "aliases": ["First"], "id": 1}]}`
+
+	migrated, from, err := MigrateConfig([]byte(data), FormatJSON)
+	if err != nil {
+		t.Fatalf("MigrateConfig failed: %v", err)
+	}
+
+	if from != 1 {
+		t.Errorf("Expected version 1 for a config without a version, got %d", from)
+	}
+	want := `{
+  "version": 2,
+  "chats": [
+    {
+      "id": 1,
+      "aliases": ["First"],
+      "child_chats": []
+    }
+  ],
+  "help_contacts": ["@Karas"]
+}
+`
+	if diff := cmp.Diff(want, string(migrated)); diff != "" {
+		t.Errorf("Wrong migrated config, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestMigrateConfigKeepsUnknownFields(t *testing.T) {
+	migrated, _, err := MigrateConfig([]byte(`{"zzz": {"b": 1, "a": [1, 2]}, "version": 2}`), FormatJSON)
+	if err != nil {
+		t.Fatalf("MigrateConfig failed: %v", err)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(migrated, &doc); err != nil {
+		t.Fatalf("Migrated config isn't valid JSON: %v\n%s", err, migrated)
+	}
+	if !strings.Contains(string(migrated), `"a": [1, 2]`) {
+		t.Errorf("Expected the unknown field to be kept, got:\n%s", migrated)
+	}
+}
+
+func TestMigrateConfigRejectsNewerVersion(t *testing.T) {
+	_, _, err := MigrateConfig([]byte(`{"version": 99}`), FormatJSON)
+
+	if err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("Expected an error about a newer version, got %v", err)
+	}
+}
+
+func TestParseConfigWarnsAboutOldVersion(t *testing.T) {
+	data := `{"chats": [{"id": 1, "aliases": ["First"]}], "help_contacts": ["@Karas"]}`
+
+	config, problems := ParseConfig([]byte(data))
+
+	if err := problems.Err(); err != nil {
+		t.Fatalf("An old version has to be accepted, got %v", err)
+	}
+	if len(problems.Warnings()) != 1 || problems[0].Path != "version" {
+		t.Errorf("Expected a single warning about the version, got %v", problems)
+	}
+	if config.Version != CurrentConfigVersion {
+		t.Errorf("Expected version %d after migration, got %d", CurrentConfigVersion, config.Version)
+	}
+}
+
+func TestParseConfigRejectsBadVersion(t *testing.T) {
+	for _, version := range []string{`"2"`, `0`, `99`} {
+		_, problems := ParseConfig([]byte(`{"version": ` + version + `, "chats": [], "help_contacts": []}`))
+
+		if len(problems) != 1 || problems[0].Path != "version" || problems.Err() == nil {
+			t.Errorf("version %s: expected a single version error, got %v", version, problems)
+		}
+	}
+}
+
+func TestMigrateYAMLConfigKeepsComments(t *testing.T) {
+	data := `# top comment
+help_contacts: ["@Karas"] # who to ask
+chats:
+  # the only chat
+  - id: 1
+    aliases: [First]
+`
+
+	migrated, _, err := MigrateConfig([]byte(data), FormatYAML)
+	if err != nil {
+		t.Fatalf("MigrateConfig failed: %v", err)
+	}
+
+	want := `# top comment
+version: 2
+help_contacts: ["@Karas"] # who to ask
+chats:
+  # the only chat
+  - id: 1
+    aliases: [First]
+`
+	if diff := cmp.Diff(want, string(migrated)); diff != "" {
+		t.Errorf("Wrong migrated config, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestMigrateTOMLConfigOrdersFields(t *testing.T) {
+	data := `help_contacts = ["@Karas"]
+
+[[chats]]
+aliases = ["First"]
+id = 1
+`
+
+	migrated, _, err := MigrateConfig([]byte(data), FormatTOML)
+	if err != nil {
+		t.Fatalf("MigrateConfig failed: %v", err)
+	}
+
+	want := `version = 2
+help_contacts = ["@Karas"]
+
+[[chats]]
+id = 1
+aliases = ["First"]
+`
+	if diff := cmp.Diff(want, string(migrated)); diff != "" {
+		t.Errorf("Wrong migrated config, cmp.Diff(want, got):\n%s", diff)
+	}
+}
@@ -0,0 +1,197 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/logging"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Modifiers change how a message reaches the chats of a tag. They're typed
+// right after the tag, like *Second!pin or *Second~silent!pin, and only
+// chat administrators may use them.
+type Modifiers struct {
+	// Silent forwards the message without a notification.
+	Silent bool
+	// Pin pins the forwarded message.
+	Pin bool
+	// Urgent forwards the message with a notification even if the chat is
+	// tagged silently too.
+	Urgent bool
+}
+
+// modifierSpellings are the modifiers as they're typed, with what they do for
+// inline suggestions. A spelling starting another one goes after it.
+var modifierSpellings = []struct {
+	spelling    string
+	description string
+	set         func(m *Modifiers)
+}{
+	{"!!urgent", "терміново, зі сповіщенням", func(m *Modifiers) { m.Urgent = true }},
+	{"!pin", "закріпити в чаті", func(m *Modifiers) { m.Pin = true }},
+	{"~silent", "без сповіщення", func(m *Modifiers) { m.Silent = true }},
+}
+
+// parseModifiers reads the modifiers at the start of the lowercased text
+// following a tag.
+func parseModifiers(text string) Modifiers {
+	m, _ := readModifiers(text)
+	return m
+}
+
+// readModifiers reads the modifiers at the start of text, in any case, and
+// returns them with how many bytes they take. A spelling counts only if the
+// word ends with it, so !pinned isn't !pin.
+func readModifiers(text string) (Modifiers, int) {
+	var m Modifiers
+	n := 0
+	for found := true; found; {
+		found = false
+		for _, s := range modifierSpellings {
+			rest := strings.ToLower(text[n:])
+			if strings.HasPrefix(rest, s.spelling) && endsWord(rest[len(s.spelling):]) {
+				s.set(&m)
+				n += len(s.spelling)
+				found = true
+				break
+			}
+		}
+	}
+	return m, n
+}
+
+// endsWord reports whether a word can end right before rest: it's empty or
+// starts with neither a letter, a digit nor an underscore.
+func endsWord(rest string) bool {
+	r, _ := utf8.DecodeRuneInString(rest)
+	return rest == "" || !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+}
+
+// splitModifiers splits the modifiers typed after a tag with any of prefixes,
+// in full or not, off the tag.
+func splitModifiers(prefixes []string, token string) (tag, modifiers string) {
+	prefix, _ := splitTag(prefixes, token)
+	start := len(prefix)
+	for _, q := range tagQuotes {
+		if !strings.HasPrefix(token[start:], q.open) {
+			continue
+		}
+		if j := strings.Index(token[start+len(q.open):], q.close); j >= 0 {
+			start += len(q.open) + j + len(q.close)
+		}
+		break
+	}
+	if i := strings.IndexAny(token[start:], "!~"); i >= 0 {
+		return token[:start+i], token[start+i:]
+	}
+	return token, ""
+}
+
+// isModifierSuffix reports whether s may be modifiers typed after a tag, in
+// full or not.
+func isModifierSuffix(s string) bool {
+	return s == "" || strings.IndexAny(s, "!~") == 0 && !strings.ContainsAny(s, " \n\t")
+}
+
+// modifierCompletions returns the modifiers typed after a tag followed by
+// each modifier not typed yet that the rest of them starts.
+func modifierCompletions(typed string) []string {
+	done, n := readModifiers(typed)
+	rest := strings.ToLower(typed[n:])
+	var completions []string
+	for _, s := range modifierSpellings {
+		var m Modifiers
+		s.set(&m)
+		if done.merge(m) != done && strings.HasPrefix(s.spelling, rest) {
+			completions = append(completions, typed[:n]+s.spelling)
+		}
+	}
+	return completions
+}
+
+// DescribeModifiers says what the modifiers do.
+func DescribeModifiers(m Modifiers) string {
+	var descriptions []string
+	for _, s := range modifierSpellings {
+		var one Modifiers
+		s.set(&one)
+		if m.merge(one) == m {
+			descriptions = append(descriptions, s.description)
+		}
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// IsZero reports whether no modifier is set.
+func (m Modifiers) IsZero() bool {
+	return m == Modifiers{}
+}
+
+// merge sets the modifiers set in either m or other.
+func (m Modifiers) merge(other Modifiers) Modifiers {
+	return Modifiers{Silent: m.Silent || other.Silent, Pin: m.Pin || other.Pin, Urgent: m.Urgent || other.Urgent}
+}
+
+func (m Modifiers) String() string {
+	var names []string
+	if m.Urgent {
+		names = append(names, "urgent")
+	}
+	if m.Pin {
+		names = append(names, "pin")
+	}
+	if m.Silent {
+		names = append(names, "silent")
+	}
+	return strings.Join(names, ", ")
+}
+
+// authorizeModifiers drops the modifiers of the deliveries to chats where the
+// sender of message isn't an administrator, and tells them so.
+func (bh Handler) authorizeModifiers(logger *logging.Logger, current *snapshot, plan Plan, message *tgbotapi.Message) Plan {
+	var denied []string
+	for i, d := range plan.Deliveries {
+		if d.Modifiers.IsZero() {
+			continue
+		}
+		if message.From != nil && bh.isAdmin(logger, d.ChatID, message.From.ID) {
+			continue
+		}
+		plan.Deliveries[i].Modifiers = Modifiers{}
+		node, _ := current.router.Index().Node(d.ChatID)
+		denied = append(denied, bh.chatTitle(logger, node.Chat))
+	}
+	if len(denied) > 0 {
+		msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf(
+			"Модифікатори доставки можуть використовувати лише адміністратори чату. Переслано без них у: %s.",
+			strings.Join(denied, ", ")))
+		msg.ReplyToMessageID = message.MessageID
+		bh.send(logger, msg)
+	}
+	return plan
+}
+
+// isAdmin reports whether the user is an administrator or the creator of the
+// chat. Users whose status can't be fetched aren't.
+func (bh Handler) isAdmin(logger *logging.Logger, chatID int64, userID int) bool {
+	member, err := bh.bot.GetChatMember(tgbotapi.ChatConfigWithUser{ChatID: chatID, UserID: userID})
+	if err != nil {
+		bh.metrics.SendFailed(ErrorCode(err))
+		logger.Warn("Failed to get chat member", "to_chat_id", chatID, "error", logging.RedactError(err))
+		return false
+	}
+	return member.IsAdministrator() || member.IsCreator()
+}
+
+// pin pins the message forwarded to a chat. The bot has to be allowed to pin
+// messages there.
+func (bh Handler) pin(logger *logging.Logger, chatID int64, messageID int, silent bool) {
+	_, err := bh.bot.PinChatMessage(tgbotapi.PinChatMessageConfig{ChatID: chatID, MessageID: messageID, DisableNotification: silent})
+	if err != nil {
+		bh.metrics.SendFailed(ErrorCode(err))
+		logger.Warn("Failed to pin message", "to_chat_id", chatID, "error", logging.RedactError(err))
+	}
+}
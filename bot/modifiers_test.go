@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseModifiers(t *testing.T) {
+	for _, testCase := range []struct {
+		text string
+		want Modifiers
+	}{
+		{text: "", want: Modifiers{}},
+		{text: " !pin", want: Modifiers{}},
+		{text: "!pin and more", want: Modifiers{Pin: true}},
+		{text: "~silent!pin", want: Modifiers{Silent: true, Pin: true}},
+		{text: "!!urgent", want: Modifiers{Urgent: true}},
+		{text: "!!URGENT~silent", want: Modifiers{Urgent: true, Silent: true}},
+		{text: "!pinned", want: Modifiers{}},
+		{text: "!pinned~silent", want: Modifiers{}},
+		{text: "~silently", want: Modifiers{}},
+		{text: "!pin, please", want: Modifiers{Pin: true}},
+		{text: "!pin\n", want: Modifiers{Pin: true}},
+		{text: "~silent!pinned", want: Modifiers{Silent: true}},
+		{text: "!silent", want: Modifiers{}},
+	} {
+		if got := parseModifiers(testCase.text); got != testCase.want {
+			t.Errorf("parseModifiers(%q) = %+v, want %+v", testCase.text, got, testCase.want)
+		}
+	}
+}
+
+func TestRouterRoutesModifiers(t *testing.T) {
+	router := NewRouter(config)
+
+	plan := router.Route(1, "*second!pin and *second~silent, *tenth!!urgent")
+
+	want := []Delivery{
+		{ChatID: 2, Aliases: []string{"Second"}, Modifiers: Modifiers{Pin: true, Silent: true}},
+		{ChatID: 10, Aliases: []string{"Tenth"}, Modifiers: Modifiers{Urgent: true}},
+	}
+	if diff := cmp.Diff(want, plan.Deliveries); diff != "" {
+		t.Errorf("Wrong deliveries, cmp.Diff(want, got):\n%s", diff)
+	}
+	var modifierRules []AppliedRule
+	for _, rule := range plan.Rules {
+		if rule.Rule == RuleModifiers {
+			modifierRules = append(modifierRules, rule)
+		}
+	}
+	wantRules := []AppliedRule{
+		{Rule: RuleModifiers, Detail: "chat 2 gets the message with pin, silent"},
+		{Rule: RuleModifiers, Detail: "chat 10 gets the message with urgent"},
+	}
+	if diff := cmp.Diff(wantRules, modifierRules); diff != "" {
+		t.Errorf("Wrong modifier rules, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestModifiersNeedAdmins(t *testing.T) {
+	bot := &fakeBot{admins: map[int64][]int{2: {7}}}
+	handler := NewHandler(config, bot)
+	send := func(userID int, text string) {
+		bot.sentMessages, bot.pins = nil, nil
+		handler.HandleUpdate(tgbotapi.Update{Message: &tgbotapi.Message{
+			Chat: &tgbotapi.Chat{ID: 1, Title: "First"}, From: &tgbotapi.User{ID: userID}, MessageID: 42, Text: text,
+		}})
+	}
+
+	send(7, "News *second~silent!pin")
+	header := tgbotapi.NewMessage(2, "Пересилаю повідомлення з чату First")
+	header.DisableNotification = true
+	forward := tgbotapi.NewForward(2, 1, 42)
+	forward.DisableNotification = true
+	if diff := cmp.Diff([]tgbotapi.Chattable{header, forward}, bot.sentMessages); diff != "" {
+		t.Errorf("Expected a silent forward, cmp.Diff(want, got):\n%s", diff)
+	}
+	// The fake bot numbers the sent messages, the forward is the second one.
+	pin := tgbotapi.PinChatMessageConfig{ChatID: 2, MessageID: 2, DisableNotification: true}
+	if diff := cmp.Diff([]tgbotapi.PinChatMessageConfig{pin}, bot.pins); diff != "" {
+		t.Errorf("Expected the forward to be pinned, cmp.Diff(want, got):\n%s", diff)
+	}
+
+	send(7, "News *second~silent!!urgent")
+	if forward := bot.sentMessages[1].(tgbotapi.ForwardConfig); forward.DisableNotification {
+		t.Errorf("Expected urgent messages to notify even if tagged silently, got %+v", forward)
+	}
+
+	send(8, "News *second!pin")
+	denied := tgbotapi.NewMessage(1,
+		"Модифікатори доставки можуть використовувати лише адміністратори чату. Переслано без них у: Chat 2.")
+	denied.ReplyToMessageID = 42
+	want := []tgbotapi.Chattable{denied, tgbotapi.NewMessage(2, "Пересилаю повідомлення з чату First"), tgbotapi.NewForward(2, 1, 42)}
+	if diff := cmp.Diff(want, bot.sentMessages); diff != "" {
+		t.Errorf("Expected modifiers of non-admins to be dropped, cmp.Diff(want, got):\n%s", diff)
+	}
+	if len(bot.pins) != 0 {
+		t.Errorf("Expected nothing pinned for non-admins, got %+v", bot.pins)
+	}
+}
+
+func TestHashtagModifiers(t *testing.T) {
+	config := multiWordConfig
+	config.TagPrefixes = []string{"#"}
+	router := NewRouter(config)
+
+	plan := router.RouteTexts(1, TaggedText{Text: "#Cork_Events!pin", Hashtags: []string{"Cork_Events"}})
+
+	want := []Delivery{{ChatID: 2, Aliases: []string{"Cork Events"}, Modifiers: Modifiers{Pin: true}}}
+	if diff := cmp.Diff(want, plan.Deliveries); diff != "" {
+		t.Errorf("Wrong deliveries, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestInlineSuggestsModifiers(t *testing.T) {
+	bot := &fakeBot{}
+	handler := NewHandler(config, bot)
+	titles := func(query string) []string {
+		handler.HandleUpdate(tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{Query: query}})
+		var titles []string
+		for _, result := range bot.inlineConfig.Results {
+			titles = append(titles, result.(tgbotapi.InlineQueryResultArticle).Title)
+		}
+		return titles
+	}
+
+	for _, testCase := range []struct {
+		query string
+		want  []string
+	}{
+		{query: "*second", want: []string{"*Second", "*Second!!urgent", "*Second!pin", "*Second~silent"}},
+		{query: "*second!", want: []string{"*Second!!urgent", "*Second!pin"}},
+		{query: "*second~silent!", want: []string{"*Second~silent!!urgent", "*Second~silent!pin"}},
+		{query: "*secon!", want: nil},
+	} {
+		if diff := cmp.Diff(testCase.want, titles(testCase.query)); diff != "" {
+			t.Errorf("Wrong suggestions for %q, cmp.Diff(want, got):\n%s", testCase.query, diff)
+		}
+	}
+
+	titles("*second!p")
+	if got := bot.inlineConfig.Results[0].(tgbotapi.InlineQueryResultArticle).Description; got != "→ Chat 2 (1 chat)\nзакріпити в чаті" {
+		t.Errorf("Expected the suggestion to say what the modifier does, got %q", got)
+	}
+}
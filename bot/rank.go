@@ -0,0 +1,175 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/store"
+)
+
+// How well an alias matches a typed word, better matches score lower. Typos
+// score matchTypo plus their number.
+const (
+	matchExact = iota
+	matchPrefix
+	matchWordStart
+	matchSubstring
+	matchTypo
+)
+
+// matchScore scores alias for the word being typed, without its "*" and
+// quotes, by the best match of their spellings, whatever separates words. It
+// reports false if they don't match at all.
+func matchScore(alias, word string) (int, bool) {
+	best, found := 0, false
+	for _, a := range aliasSpellings(strings.ToLower(alias)) {
+		for _, w := range textSpellings(strings.ToLower(word)) {
+			if score, ok := spellingScore(alias, spaceWords(a), spaceWords(w)); ok && (!found || score < best) {
+				best, found = score, true
+			}
+		}
+	}
+	return best, found
+}
+
+// spellingScore scores a spelling of alias for a spelling of the word, both
+// lowercased.
+func spellingScore(alias, a, w string) (int, bool) {
+	switch {
+	case a == w:
+		return matchExact, true
+	case strings.HasPrefix(a, w):
+		return matchPrefix, true
+	case a == strings.ToLower(alias) && startsWord(alias, w):
+		return matchWordStart, true
+	case strings.Contains(a, w):
+		return matchSubstring, true
+	}
+	if typos := maxTypos(utf8.RuneCountInString(w)); typos > 0 {
+		if d := prefixEditDistance(w, a); d <= typos {
+			return matchTypo + d, true
+		}
+	}
+	return 0, false
+}
+
+// maxTypos is how many typos a word of n letters may have and still match.
+// Short words would match nearly anything with a typo.
+func maxTypos(n int) int {
+	switch {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// startsWord reports whether the lowercased word starts one of the words of
+// alias after the first: "digit" in "DoubleDigit" or "events" in "cork_events".
+func startsWord(alias, word string) bool {
+	var prev rune
+	for i, r := range alias {
+		if i > 0 && isWordStart(prev, r) && strings.HasPrefix(strings.ToLower(alias[i:]), word) {
+			return true
+		}
+		prev = r
+	}
+	return false
+}
+
+func isWordStart(prev, r rune) bool {
+	switch {
+	case unicode.IsUpper(r) && !unicode.IsUpper(prev):
+		return true
+	case unicode.IsLetter(r) || unicode.IsDigit(r):
+		return !unicode.IsLetter(prev) && !unicode.IsDigit(prev)
+	}
+	return false
+}
+
+// rankAliases returns the aliases matching the word being typed, best matches
+// first. Equally good matches are ordered by how recently the user used them,
+// recent lists lowercased aliases most recent first, and then alphabetically.
+// An empty word matches every alias.
+func rankAliases(aliases []string, word string, recent []string) []string {
+	recency := make(map[string]int, len(recent))
+	for i, alias := range recent {
+		recency[alias] = i - len(recent)
+	}
+	type scored struct {
+		alias   string
+		score   int
+		recency int
+	}
+	var matched []scored
+	for _, alias := range aliases {
+		score := 0
+		if word != "" {
+			var ok bool
+			if score, ok = matchScore(alias, word); !ok {
+				continue
+			}
+		}
+		matched = append(matched, scored{alias: alias, score: score, recency: recency[strings.ToLower(alias)]})
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if matched[i].score != matched[j].score {
+			return matched[i].score < matched[j].score
+		}
+		return matched[i].recency < matched[j].recency
+	})
+	ranked := make([]string, len(matched))
+	for i, m := range matched {
+		ranked[i] = m.alias
+	}
+	return ranked
+}
+
+// maxRecentTags is how many of the tags a user sent last are remembered.
+const maxRecentTags = 10
+
+// recentTags remembers the tags every user sent last in the store. The lock
+// keeps concurrent updates of the same user from losing each other's tags.
+type recentTags struct {
+	mu    sync.Mutex
+	store store.Store
+}
+
+func recentTagsKey(userID int) string {
+	return fmt.Sprintf("recent_tags/%d", userID)
+}
+
+// get returns the lowercased aliases the user tagged, most recent first.
+func (rt *recentTags) get(userID int) ([]string, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	var recent []string
+	_, err := rt.store.Get(recentTagsKey(userID), &recent)
+	return recent, err
+}
+
+// add puts aliases in front of the tags the user used recently.
+func (rt *recentTags) add(userID int, aliases ...string) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	var old []string
+	if _, err := rt.store.Get(recentTagsKey(userID), &old); err != nil {
+		return err
+	}
+	recent := make([]string, 0, maxRecentTags)
+	seen := make(map[string]bool)
+	for _, alias := range append(append([]string{}, aliases...), old...) {
+		alias = strings.ToLower(alias)
+		if !seen[alias] && len(recent) < maxRecentTags {
+			seen[alias] = true
+			recent = append(recent, alias)
+		}
+	}
+	return rt.store.Put(recentTagsKey(userID), recent)
+}
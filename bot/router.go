@@ -0,0 +1,153 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Rules a Router reports in Plan.Rules.
+const (
+	// RuleUnknownSource stops routing of messages from chats outside the config.
+	RuleUnknownSource = "unknown-source"
+	// RuleTagMatch sends a message to every chat of an alias tagged in it.
+	RuleTagMatch = "tag-match"
+	// RuleACL skips chats whose AcceptFrom doesn't allow the source chat.
+	RuleACL = "acl"
+	// RuleSingleDelivery sends a message to a chat once even if several of
+	// the chat aliases are tagged.
+	RuleSingleDelivery = "single-delivery"
+	// RuleModifiers changes how a message reaches a chat by the modifiers
+	// typed after its tags.
+	RuleModifiers = "modifiers"
+)
+
+// Router decides where a message goes. It only looks at the config, so the
+// decision can be previewed without talking to Telegram.
+type Router struct {
+	config Config
+	index  *Index
+}
+
+func NewRouter(config Config) Router {
+	return Router{config: config, index: NewIndex(config)}
+}
+
+// Index returns the Index the Router looks chats and tags up in.
+func (r Router) Index() *Index {
+	return r.index
+}
+
+// Plan is the routing decision for a single message.
+type Plan struct {
+	FromChatID int64
+	// SourceKnown is false for messages from chats outside the config.
+	SourceKnown bool
+	// Aliases are the tagged aliases in the order of the config.
+	Aliases    []string
+	Deliveries []Delivery
+	Rules      []AppliedRule
+}
+
+// Delivery is a chat the message has to be forwarded to.
+type Delivery struct {
+	ChatID int64
+	// Aliases are the tagged aliases of the chat.
+	Aliases []string
+	// Modifiers are typed after the tags of the chat, if any.
+	Modifiers Modifiers
+}
+
+// AppliedRule explains one step of a routing decision.
+type AppliedRule struct {
+	Rule   string
+	Detail string
+}
+
+func (ar AppliedRule) String() string {
+	return ar.Rule + ": " + ar.Detail
+}
+
+// Route decides where a message sent to the chat fromChatID goes. texts are
+// the parts of the message that may carry tags, such as its text and caption.
+func (r Router) Route(fromChatID int64, texts ...string) Plan {
+	tagged := make([]TaggedText, len(texts))
+	for i, text := range texts {
+		tagged[i] = TaggedText{Text: text}
+	}
+	return r.RouteTexts(fromChatID, tagged...)
+}
+
+// RouteTexts is Route for texts with the hashtags Telegram found in them.
+func (r Router) RouteTexts(fromChatID int64, texts ...TaggedText) Plan {
+	plan := Plan{FromChatID: fromChatID}
+
+	if _, ok := r.index.Node(fromChatID); !ok {
+		plan.addRule(RuleUnknownSource, "chat %d isn't in the config", fromChatID)
+		return plan
+	}
+	plan.SourceKnown = true
+
+	tagged := r.index.TaggedAliases(r.index.Prefixes(fromChatID), texts...)
+	var positions []int
+	seen := make(map[int]bool)
+	for alias := range tagged {
+		for _, pos := range r.index.aliasChats[alias] {
+			if !seen[pos] {
+				seen[pos] = true
+				positions = append(positions, pos)
+			}
+		}
+	}
+	sort.Ints(positions)
+
+	matchedAliases := make(map[string]bool)
+	for _, pos := range positions {
+		chat := r.index.chats[pos]
+		var chatAliases []string
+		var modifiers Modifiers
+		for _, alias := range r.index.ChatAliases(pos) {
+			m, ok := tagged[strings.ToLower(alias)]
+			if !ok {
+				continue
+			}
+			chatAliases = append(chatAliases, alias)
+			modifiers = modifiers.merge(m)
+			if !matchedAliases[alias] {
+				matchedAliases[alias] = true
+				plan.Aliases = append(plan.Aliases, alias)
+			}
+		}
+		if !r.index.Accepts(chat.ID, fromChatID) {
+			plan.addRule(RuleACL, "chat %d doesn't accept messages from chat %d", chat.ID, fromChatID)
+			continue
+		}
+		plan.Deliveries = append(plan.Deliveries, Delivery{ChatID: chat.ID, Aliases: chatAliases, Modifiers: modifiers})
+		plan.addRule(RuleTagMatch, "%s reaches chat %d", r.index.ChatTag(fromChatID, chatAliases[0]), chat.ID)
+		if len(chatAliases) > 1 {
+			tags := make([]string, len(chatAliases))
+			for i, alias := range chatAliases {
+				tags[i] = r.index.ChatTag(fromChatID, alias)
+			}
+			plan.addRule(RuleSingleDelivery, "chat %d is tagged as %s, forwarding once",
+				chat.ID, strings.Join(tags, ", "))
+		}
+		if !modifiers.IsZero() {
+			plan.addRule(RuleModifiers, "chat %d gets the message with %s", chat.ID, modifiers)
+		}
+	}
+	return plan
+}
+
+func (p *Plan) addRule(rule, format string, args ...interface{}) {
+	p.Rules = append(p.Rules, AppliedRule{Rule: rule, Detail: fmt.Sprintf(format, args...)})
+}
+
+// ChatIDs returns the destinations of the plan.
+func (p Plan) ChatIDs() []int64 {
+	ids := make([]int64, 0, len(p.Deliveries))
+	for _, d := range p.Deliveries {
+		ids = append(ids, d.ChatID)
+	}
+	return ids
+}
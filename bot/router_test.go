@@ -0,0 +1,144 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRouterPlans(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		from     int64
+		texts    []string
+		wantPlan Plan
+	}{
+		{name: "Unknown source chat forwards nothing",
+			from:  404,
+			texts: []string{"My message *second"},
+			wantPlan: Plan{
+				FromChatID: 404,
+				Rules:      []AppliedRule{{Rule: RuleUnknownSource, Detail: "chat 404 isn't in the config"}},
+			}},
+		{name: "No tags",
+			from:     1,
+			texts:    []string{"My message"},
+			wantPlan: Plan{FromChatID: 1, SourceKnown: true}},
+		{name: "Shared alias reaches every chat having it",
+			from:  100,
+			texts: []string{"My message *doubledigit"},
+			wantPlan: Plan{
+				FromChatID:  100,
+				SourceKnown: true,
+				Aliases:     []string{"DoubleDigit"},
+				Deliveries: []Delivery{
+					{ChatID: 10, Aliases: []string{"DoubleDigit"}},
+					{ChatID: 11, Aliases: []string{"DoubleDigit"}},
+				},
+				Rules: []AppliedRule{
+					{Rule: RuleTagMatch, Detail: "*DoubleDigit reaches chat 10"},
+					{Rule: RuleTagMatch, Detail: "*DoubleDigit reaches chat 11"},
+				},
+			}},
+		{name: "A chat tagged twice gets one delivery",
+			from:  1,
+			texts: []string{"My message", "caption *second *singledigit"},
+			wantPlan: Plan{
+				FromChatID:  1,
+				SourceKnown: true,
+				Aliases:     []string{"SingleDigit", "Second"},
+				Deliveries: []Delivery{
+					{ChatID: 1, Aliases: []string{"SingleDigit"}},
+					{ChatID: 2, Aliases: []string{"Second", "SingleDigit"}},
+				},
+				Rules: []AppliedRule{
+					{Rule: RuleTagMatch, Detail: "*SingleDigit reaches chat 1"},
+					{Rule: RuleTagMatch, Detail: "*Second reaches chat 2"},
+					{Rule: RuleSingleDelivery, Detail: "chat 2 is tagged as *Second, *SingleDigit, forwarding once"},
+				},
+			}},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			plan := NewRouter(config).Route(testCase.from, testCase.texts...)
+
+			if diff := cmp.Diff(testCase.wantPlan, plan); diff != "" {
+				t.Errorf("Route returned a wrong plan, cmp.Diff(want, got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestRouterHonoursACLs(t *testing.T) {
+	aclConfig := Config{Chats: []Chat{
+		{ID: 1, Aliases: NewAliases("First")},
+		{ID: 2, Aliases: NewAliases("Second")},
+		{ID: 3, Aliases: NewAliases("Announcements"), AcceptFrom: []string{"First"}},
+	}}
+	router := NewRouter(aclConfig)
+
+	if got := router.Route(1, "*announcements").ChatIDs(); !cmp.Equal(got, []int64{3}) {
+		t.Errorf("Expected an allowed chat to reach chat 3, got %v", got)
+	}
+	plan := router.Route(2, "*announcements")
+	if len(plan.Deliveries) != 0 {
+		t.Errorf("Expected no deliveries from a chat outside accept_from, got %v", plan.Deliveries)
+	}
+	wantRules := []AppliedRule{{Rule: RuleACL, Detail: "chat 3 doesn't accept messages from chat 2"}}
+	if diff := cmp.Diff(wantRules, plan.Rules); diff != "" {
+		t.Errorf("Wrong rules, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestRouterRulesWriteTagsWithThePrefix(t *testing.T) {
+	prefixConfig := Config{TagPrefixes: []string{"#", "*"}, Chats: []Chat{
+		{ID: 1, Aliases: NewAliases("First")},
+		{ID: 2, Aliases: NewAliases("Old Town", "Centre")},
+		{ID: 3, Aliases: NewAliases("Quoted"), TagPrefixes: []string{"*"}},
+	}}
+	router := NewRouter(prefixConfig)
+
+	for _, testCase := range []struct {
+		from      int64
+		text      string
+		wantRules []AppliedRule
+	}{{
+		from: 1,
+		text: "#old_town",
+		wantRules: []AppliedRule{
+			{Rule: RuleTagMatch, Detail: "#Old_Town reaches chat 2"},
+		},
+	}, {
+		from: 1,
+		text: "#old_town #centre",
+		wantRules: []AppliedRule{
+			{Rule: RuleTagMatch, Detail: "#Old_Town reaches chat 2"},
+			{Rule: RuleSingleDelivery, Detail: "chat 2 is tagged as #Old_Town, #Centre, forwarding once"},
+		},
+	}, {
+		from: 3,
+		text: `*"old town"`,
+		wantRules: []AppliedRule{
+			{Rule: RuleTagMatch, Detail: `*"Old Town" reaches chat 2`},
+		},
+	}} {
+		plan := router.Route(testCase.from, testCase.text)
+		if diff := cmp.Diff(testCase.wantRules, plan.Rules); diff != "" {
+			t.Errorf("Wrong rules for %q from chat %d, cmp.Diff(want, got):\n%s", testCase.text, testCase.from, diff)
+		}
+	}
+}
+
+func TestChatsByRef(t *testing.T) {
+	ix := NewIndex(config)
+	for ref, wantIDs := range map[string][]int64{"10": {10}, "Eleventh": {11}, "*tenth": {10}, "doubledigit": {10, 11}} {
+		ids, ok := ix.ChatsByRef(ref)
+		if !ok || !cmp.Equal(ids, wantIDs) {
+			t.Errorf("ChatsByRef(%q) = %v, %v; want %v, true", ref, ids, ok, wantIDs)
+		}
+	}
+	for _, ref := range []string{"Nowhere", "404"} {
+		if ids, ok := ix.ChatsByRef(ref); ok {
+			t.Errorf("ChatsByRef(%q) found %v", ref, ids)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"regexp"
+	"strings"
+)
+
+// A tag is a prefix followed by an alias, *Galway by default. Configs may
+// add other prefixes, like # for hashtags, see Config.TagPrefixes.
+//
+// An alias may be several words, like "Cork Events". It's tagged in quotes,
+// *"Cork Events", or with the spaces typed as underscores or hyphens,
+// *Cork_Events or *Cork-Events. Any alias may be quoted.
+
+// DefaultTagPrefix starts tags in configs without tag prefixes.
+const DefaultTagPrefix = "*"
+
+// hashtagPrefix starts the tags Telegram recognises as hashtags. Hashtags end
+// at spaces, quotes and hyphens, so multi-word aliases are hashtagged with
+// underscores.
+const hashtagPrefix = "#"
+
+// tagQuotes are the opening quotes of quoted tags with their closing ones.
+// Phones often replace straight quotes with typographic ones.
+var tagQuotes = []struct{ open, close string }{
+	{`"`, `"`}, {"“", "”"}, {"«", "»"},
+}
+
+// tagWordPattern matches what follows a tag prefix: a quoted alias, or a word
+// up to the first character that can't be in a word.
+const tagWordPattern = `(?:"[^"\n]+"|“[^”\n]+”|«[^»\n]+»|[\p{L}\p{N}_'’-]+)`
+
+// tagTokenRegexp finds tags with any of prefixes in a text.
+func tagTokenRegexp(prefixes []string) *regexp.Regexp {
+	quoted := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		quoted[i] = regexp.QuoteMeta(prefix)
+	}
+	return regexp.MustCompile(`(?:` + strings.Join(quoted, "|") + `)` + tagWordPattern)
+}
+
+// TaggedText is a part of a message that may carry tags.
+type TaggedText struct {
+	Text string
+	// Hashtags are the hashtags Telegram found in Text, without the "#". If
+	// they're known, they're matched instead of the # tags in Text.
+	Hashtags []string
+}
+
+// Tag returns how alias is tagged with DefaultTagPrefix, see TagWith.
+func Tag(alias string) string {
+	return TagWith(DefaultTagPrefix, alias)
+}
+
+// TagWith returns how alias is tagged in messages with prefix: the prefix and
+// the alias, in quotes if it's several words, or with underscores instead of
+// the spaces and hyphens if it's a hashtag.
+func TagWith(prefix, alias string) string {
+	if prefix == hashtagPrefix {
+		return prefix + strings.NewReplacer(" ", "_", "-", "_").Replace(alias)
+	}
+	if strings.Contains(alias, " ") {
+		return prefix + `"` + alias + `"`
+	}
+	return prefix + alias
+}
+
+// tagPatterns returns every way to tag the lowercased spelling of an alias
+// with prefix.
+func tagPatterns(prefix, spelling string) []string {
+	var patterns []string
+	if strings.Contains(spelling, " ") {
+		patterns = append(patterns,
+			prefix+strings.ReplaceAll(spelling, " ", "_"), prefix+strings.ReplaceAll(spelling, " ", "-"))
+	} else {
+		patterns = append(patterns, prefix+spelling)
+	}
+	for _, q := range tagQuotes {
+		patterns = append(patterns, prefix+q.open+spelling+q.close)
+	}
+	return patterns
+}
+
+// splitTag splits a tag into the longest of prefixes it starts with and the
+// rest, without quotes. A word without any of prefixes has none.
+func splitTag(prefixes []string, token string) (prefix, word string) {
+	for _, p := range prefixes {
+		if strings.HasPrefix(token, p) && len(p) > len(prefix) {
+			prefix = p
+		}
+	}
+	word = strings.TrimPrefix(token, prefix)
+	for _, q := range tagQuotes {
+		if strings.HasPrefix(word, q.open) {
+			return prefix, strings.TrimSuffix(strings.TrimPrefix(word, q.open), q.close)
+		}
+	}
+	return prefix, word
+}
+
+// wordSeparators replaces the characters typed instead of spaces in tags.
+var wordSeparators = strings.NewReplacer("_", " ", "-", " ")
+
+// spaceWords spells the lowercased words of a tag or an alias with spaces
+// between them, whatever separates them, to compare the two.
+func spaceWords(s string) string {
+	return wordSeparators.Replace(s)
+}
@@ -0,0 +1,194 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/google/go-cmp/cmp"
+)
+
+var multiWordConfig = Config{
+	Chats: []Chat{
+		{ID: 1, Title: "Dublin", Aliases: NewAliases("Dublin Volunteers")},
+		{ID: 2, Title: "Cork", Aliases: NewAliases("Cork Events", "Munster")},
+		{ID: 3, Title: "Galway", Aliases: NewAliases("Galway")},
+	},
+	HelpContacts: []string{"@Karas"},
+}
+
+func TestRouterMatchesMultiWordTags(t *testing.T) {
+	router := NewRouter(multiWordConfig)
+
+	for text, want := range map[string][]int64{
+		`See *"Cork Events"`:           {2},
+		"See *cork_events":             {2},
+		"See *Dublin-Volunteers today": {1},
+		"See *“dublin volunteers”":     {1},
+		"See *«Galway»":                {3},
+		"See *dublin volunteers":       {},
+		`See *"Dublin"`:                {},
+	} {
+		if got := router.Route(3, text).ChatIDs(); !cmp.Equal(got, want) {
+			t.Errorf("Route(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestTag(t *testing.T) {
+	for alias, want := range map[string]string{"Galway": "*Galway", "Cork Events": `*"Cork Events"`} {
+		if got := Tag(alias); got != want {
+			t.Errorf("Tag(%q) = %s, want %s", alias, got, want)
+		}
+	}
+}
+
+func TestSplitQuery(t *testing.T) {
+	for query, want := range map[string][2]string{
+		"Hi *ga":                   {"Hi ", "*ga"},
+		`Hi *"cork ev`:             {"Hi ", `*"cork ev`},
+		`Hi *"cork events" `:       {"Hi ", `*"cork events"`},
+		`Hi *«cork`:                {"Hi ", `*«cork`},
+		`Hi *"cork events" and *g`: {`Hi *"cork events" and `, "*g"},
+		"a   ":                     {"", "a"},
+		"*sec ":                    {"", "*sec"},
+		"sec ":                     {"", "sec"},
+		"Some msg *first ":         {"Some msg ", "*first"},
+		"Some msg first ":          {"Some msg ", "first"},
+		"Hi *ga\t":                 {"Hi ", "*ga"},
+		"Hi ga\t":                  {"Hi ", "ga"},
+		"Hi *ga\n":                 {"Hi ", "*ga"},
+		"Hi ga\n":                  {"Hi ", "ga"},
+	} {
+		draft, lastWord := splitQuery([]string{"*"}, query)
+		if got := [2]string{draft, lastWord}; got != want {
+			t.Errorf("splitQuery(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestMultiWordTagsInSuggestions(t *testing.T) {
+	bot := &fakeBot{}
+	handler := NewHandler(multiWordConfig, bot)
+
+	for query, want := range map[string][]string{
+		`Hi *"cork ev`: {`Hi *"Cork Events"`},
+		"Hi *cork_e":   {`Hi *"Cork Events"`},
+		"Hi *dubl":     {`Hi *"Dublin Volunteers"`},
+	} {
+		handler.HandleUpdate(tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{Query: query}})
+		var got []string
+		for _, result := range bot.inlineConfig.Results {
+			got = append(got, result.(tgbotapi.InlineQueryResultArticle).InputMessageContent.(tgbotapi.InputTextMessageContent).Text)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Wrong suggestions for %q, cmp.Diff(want, got):\n%s", query, diff)
+		}
+	}
+
+	bot.sentMessages = nil
+	handler.HandleUpdate(tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 3}, From: &tgbotapi.User{}, Text: "/help",
+		Entities: &[]tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: 5}},
+	}})
+	if help := bot.sentMessages[0].(tgbotapi.MessageConfig).Text; !strings.Contains(help, `*"cork events" *"dublin volunteers" *galway *munster`) {
+		t.Errorf("Expected /help to list multi-word tags quoted, got %q", help)
+	}
+
+	bot.sentMessages = nil
+	handler.HandleUpdate(tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 3}, From: &tgbotapi.User{}, MessageID: 42, Text: `See *"Cork Evnets"`,
+	}})
+	want := tgbotapi.NewMessage(3, `Тег *"Cork Evnets" не знайдено. Можливо, *"Cork Events"?`)
+	want.ReplyToMessageID = 42
+	want.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(`Переслати в *"Cork Events"`, "retag:Cork Events")))
+	if diff := cmp.Diff([]tgbotapi.Chattable{want}, bot.sentMessages); diff != "" {
+		t.Errorf("Wrong hint for a misspelled quoted tag, cmp.Diff(want, got):\n%s", diff)
+	}
+}
+
+func TestValidateAcceptsMultiWordAliases(t *testing.T) {
+	if problems := multiWordConfig.Validate(); len(problems) != 0 {
+		t.Errorf("Expected multi-word aliases to be valid, got %v", problems)
+	}
+}
+
+func TestTagPrefixes(t *testing.T) {
+	config := multiWordConfig
+	config.TagPrefixes = []string{"*", "#"}
+	config.Chats = append([]Chat{}, config.Chats...)
+	config.Chats[0].TagPrefixes = []string{"#"}
+	router := NewRouter(config)
+
+	for _, testCase := range []struct {
+		from int64
+		text string
+		want []int64
+	}{
+		{from: 3, text: "#galway", want: []int64{3}},
+		{from: 3, text: "*galway and #cork_events", want: []int64{2, 3}},
+		{from: 1, text: "#munster", want: []int64{2}},
+		{from: 1, text: "*munster", want: []int64{}},
+	} {
+		if got := router.Route(testCase.from, testCase.text).ChatIDs(); !cmp.Equal(got, testCase.want) {
+			t.Errorf("Route(%d, %q) = %v, want %v", testCase.from, testCase.text, got, testCase.want)
+		}
+	}
+}
+
+func TestHashtagEntities(t *testing.T) {
+	config := multiWordConfig
+	config.TagPrefixes = []string{"#"}
+	bot := &fakeBot{}
+	handler := NewHandler(config, bot)
+	forwardedTo := func(msg tgbotapi.Message) []int64 {
+		bot.sentMessages = nil
+		msg.Chat, msg.From = &tgbotapi.Chat{ID: 1}, &tgbotapi.User{}
+		handler.HandleUpdate(tgbotapi.Update{Message: &msg})
+		ids := []int64{}
+		for _, sent := range bot.sentMessages {
+			if forward, ok := sent.(tgbotapi.ForwardConfig); ok {
+				ids = append(ids, forward.ChatID)
+			}
+		}
+		return ids
+	}
+
+	// Entities count UTF-16 code units, the Cyrillic letters are a byte longer.
+	got := forwardedTo(tgbotapi.Message{Text: "Привіт #Munster і #Cork_Events", Entities: &[]tgbotapi.MessageEntity{
+		{Type: "hashtag", Offset: 7, Length: 8}, {Type: "hashtag", Offset: 18, Length: 12},
+	}})
+	if !cmp.Equal(got, []int64{2}) {
+		t.Errorf("Expected the hashtags to tag chat 2, forwarded to %v", got)
+	}
+	got = forwardedTo(tgbotapi.Message{Text: "#Munsterland", Entities: &[]tgbotapi.MessageEntity{
+		{Type: "hashtag", Offset: 0, Length: 12},
+	}})
+	if len(got) != 0 {
+		t.Errorf("Expected a hashtag only to tag the alias it spells, forwarded to %v", got)
+	}
+	if got := forwardedTo(tgbotapi.Message{Caption: "#Munster"}); !cmp.Equal(got, []int64{2}) {
+		t.Errorf("Expected hashtags in captions without entities to be found in the text, forwarded to %v", got)
+	}
+
+	handler.HandleUpdate(tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{Query: "See #cork"}})
+	if got := bot.inlineConfig.Results[0].(tgbotapi.InlineQueryResultArticle).Title; got != "#Cork_Events" {
+		t.Errorf("Expected the suggestion to be a hashtag, got %s", got)
+	}
+}
+
+func TestHelpNamesTagPrefixes(t *testing.T) {
+	config := multiWordConfig
+	config.TagPrefixes = []string{"#", "*"}
+	bot := &fakeBot{}
+	NewHandler(config, bot).HandleUpdate(tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: 3}, From: &tgbotapi.User{}, Text: "/help",
+		Entities: &[]tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: 5}},
+	}})
+
+	help := bot.sentMessages[0].(tgbotapi.MessageConfig).Text
+	if !strings.Contains(help, "#cork_events #dublin_volunteers #galway #munster\nТеги можна починати з # або *.") {
+		t.Errorf("Expected /help to list hashtags and name the prefixes, got %q", help)
+	}
+}
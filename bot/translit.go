@@ -0,0 +1,207 @@
+package bot
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Most members type in Ukrainian, so a tag may come in Cyrillic, like
+// *асгард for *Asgard, or in the wrong keyboard layout, like *фіпфкв. Tags are
+// matched in all spellings an alias or a text may have.
+
+// ukrainianLatin transliterates Ukrainian letters by the national standard,
+// the 2010 resolution of the Cabinet of Ministers.
+var ukrainianLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "h", 'ґ': "g", 'д': "d", 'е': "e", 'є': "ie",
+	'ж': "zh", 'з': "z", 'и': "y", 'і': "i", 'ї': "i", 'й': "i", 'к': "k", 'л': "l",
+	'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ь': "", 'ю': "iu",
+	'я': "ia",
+}
+
+// ukrainianLatinInitial are the letters spelled differently at the start of a
+// word.
+var ukrainianLatinInitial = map[rune]string{
+	'є': "ye", 'ї': "yi", 'й': "y", 'ю': "yu", 'я': "ya",
+}
+
+// isApostrophe reports whether r is one of the apostrophes used inside
+// Ukrainian words. The standard drops them.
+func isApostrophe(r rune) bool {
+	return r == '\'' || r == '’' || r == 'ʼ'
+}
+
+// transliterate spells the lowercased s in Latin letters by the national
+// standard. Everyday spelling often renders г as g, as in Asgard for
+// Асгард, and hardG does so.
+func transliterate(s string, hardG bool) string {
+	var b strings.Builder
+	var prev rune
+	inWord := false
+	for _, r := range s {
+		latin, ok := ukrainianLatin[r]
+		switch {
+		case !ok:
+			if !isApostrophe(r) || !inWord {
+				b.WriteRune(r)
+			}
+		case r == 'г' && hardG:
+			b.WriteString("g")
+		case r == 'г' && prev == 'з':
+			// зг is zgh to tell it from ж.
+			b.WriteString("gh")
+		case !inWord && ukrainianLatinInitial[r] != "":
+			b.WriteString(ukrainianLatinInitial[r])
+		default:
+			b.WriteString(latin)
+		}
+		if !isApostrophe(r) {
+			inWord = unicode.IsLetter(r)
+			prev = r
+		}
+	}
+	return b.String()
+}
+
+// The keys of the Ukrainian layout and those of the US one in the same places.
+const (
+	ukrainianKeys = "йцукенгшщзхїфівапролджєячсмитьбю"
+	latinKeys     = "qwertyuiop[]asdfghjkl;'zxcvbnm,."
+)
+
+var (
+	cyrillicToLatinKeys = keyMap(ukrainianKeys+"ыэъ", latinKeys[:32]+"s']")
+	latinToCyrillicKeys = keyMap(latinKeys, ukrainianKeys)
+)
+
+func keyMap(from, to string) map[rune]rune {
+	f, t := []rune(from), []rune(to)
+	m := make(map[rune]rune, len(f))
+	for i := range f {
+		m[f[i]] = t[i]
+	}
+	return m
+}
+
+// swapLayout retypes the lowercased s as if the other keyboard layout were
+// on: keys maps the letters typed to the ones meant.
+func swapLayout(s string, keys map[rune]rune) string {
+	return strings.Map(func(r rune) rune {
+		if meant, ok := keys[r]; ok {
+			return meant
+		}
+		return r
+	}, s)
+}
+
+// swapTagLayout retypes the tags with any of prefixes in the lowercased text
+// that have letters of script, see swapLayout. A tag is the run of keys
+// following a prefix, or the quoted words following it. The rest of the text
+// is kept as it is. It reports false if no tag was retyped.
+func swapTagLayout(text string, prefixes []string, keys map[rune]rune, script *unicode.RangeTable) (string, bool) {
+	var b strings.Builder
+	swapped := false
+	for i := 0; i < len(text); {
+		prefix, _ := splitTag(prefixes, text[i:])
+		if prefix == "" {
+			r, size := utf8.DecodeRuneInString(text[i:])
+			b.WriteRune(r)
+			i += size
+			continue
+		}
+		b.WriteString(prefix)
+		i += len(prefix)
+		end := i + tagRunLength(text[i:], keys)
+		if run := text[i:end]; strings.IndexFunc(run, func(r rune) bool { return unicode.Is(script, r) }) >= 0 {
+			b.WriteString(swapLayout(run, keys))
+			swapped = true
+		} else {
+			b.WriteString(run)
+		}
+		i = end
+	}
+	return b.String(), swapped
+}
+
+// tagRunLength returns how many bytes the tag at the start of text takes
+// without its prefix: the quoted words if it starts with a quote closed on
+// the same line, the keys, underscores and hyphens otherwise.
+func tagRunLength(text string, keys map[rune]rune) int {
+	for _, q := range tagQuotes {
+		if !strings.HasPrefix(text, q.open) {
+			continue
+		}
+		quoted := text[len(q.open):]
+		if j := strings.Index(quoted, q.close); j >= 0 && !strings.Contains(quoted[:j], "\n") {
+			return len(q.open) + j + len(q.close)
+		}
+	}
+	end := strings.IndexFunc(text, func(r rune) bool {
+		_, ok := keys[r]
+		return !ok && r != '_' && r != '-'
+	})
+	if end < 0 {
+		return len(text)
+	}
+	return end
+}
+
+// hasCyrillic reports whether s has Cyrillic letters, which are the only ones
+// transliteration changes.
+func hasCyrillic(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool { return unicode.Is(unicode.Cyrillic, r) }) >= 0
+}
+
+// aliasSpellings returns the distinct ways to spell the lowercased alias: as
+// it is and transliterated, so that Latin tags find Cyrillic aliases.
+func aliasSpellings(alias string) []string {
+	spellings := []string{alias}
+	if hasCyrillic(alias) {
+		spellings = appendDistinct(spellings, transliterate(alias, false), transliterate(alias, true))
+	}
+	return spellings
+}
+
+// messageSpellings returns the distinct ways to read the lowercased text of a
+// message with tags starting with any of prefixes: as it is, transliterated,
+// and with the tags typed in the wrong script retyped in the other keyboard
+// layout. Words that aren't tags aren't retyped, so they can't turn into a
+// tag of an alias in the other script.
+func messageSpellings(text string, prefixes []string) []string {
+	spellings := []string{text}
+	if hasCyrillic(text) {
+		spellings = appendDistinct(spellings, transliterate(text, false), transliterate(text, true))
+		if swapped, ok := swapTagLayout(text, prefixes, cyrillicToLatinKeys, unicode.Cyrillic); ok {
+			spellings = appendDistinct(spellings, swapped)
+		}
+	}
+	if swapped, ok := swapTagLayout(text, prefixes, latinToCyrillicKeys, unicode.Latin); ok {
+		spellings = appendDistinct(spellings, swapped)
+	}
+	return spellings
+}
+
+// textSpellings returns the distinct ways to read the lowercased tag word
+// text: as it is, transliterated, and retyped in the other keyboard layout.
+func textSpellings(text string) []string {
+	spellings := []string{text}
+	if hasCyrillic(text) {
+		spellings = appendDistinct(spellings,
+			transliterate(text, false), transliterate(text, true), swapLayout(text, cyrillicToLatinKeys))
+	}
+	return appendDistinct(spellings, swapLayout(text, latinToCyrillicKeys))
+}
+
+func appendDistinct(list []string, items ...string) []string {
+	for _, item := range items {
+		found := false
+		for _, s := range list {
+			found = found || s == item
+		}
+		if !found {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,131 @@
+package bot
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTransliterate(t *testing.T) {
+	for _, testCase := range []struct {
+		text, want string
+		hardG      bool
+	}{
+		{text: "київ", want: "kyiv"},
+		{text: "асгард", want: "ashard"},
+		{text: "асгард", want: "asgard", hardG: true},
+		{text: "зграя", want: "zghraia"},
+		{text: "єнакієве", want: "yenakiieve"},
+		{text: "м'ясо", want: "miaso"},
+		{text: "юлія і щука", want: "yuliia i shchuka"},
+		{text: "*їжак", want: "*yizhak"},
+		{text: "midgard", want: "midgard"},
+	} {
+		if got := transliterate(testCase.text, testCase.hardG); got != testCase.want {
+			t.Errorf("transliterate(%q, %v) = %q, want %q", testCase.text, testCase.hardG, got, testCase.want)
+		}
+	}
+}
+
+func TestSwapLayout(t *testing.T) {
+	if got := swapLayout("*фіпфкв!", cyrillicToLatinKeys); got != "*asgard!" {
+		t.Errorf("Expected *фіпфкв! to be *asgard! in the Latin layout, got %q", got)
+	}
+	if got := swapLayout("*vslufhl", latinToCyrillicKeys); got != "*мідгард" {
+		t.Errorf("Expected *vslufhl to be *мідгард in the Ukrainian layout, got %q", got)
+	}
+}
+
+func TestMessageSpellingsRetypeOnlyTags(t *testing.T) {
+	for _, testCase := range []struct {
+		text string
+		want []string
+	}{
+		{text: "give her a hand", want: []string{"give her a hand"}},
+		{text: "*vslufhl tonight", want: []string{"*vslufhl tonight", "*мідгард tonight"}},
+		{text: `see *"vslufhl gjls]" at 6`, want: []string{`see *"vslufhl gjls]" at 6`, `see *"мідгард події" at 6`}},
+		{text: "на *фіпфкв", want: []string{"на *фіпфкв", "na *fipfkv", "на *asgard"}},
+	} {
+		if diff := cmp.Diff(testCase.want, messageSpellings(testCase.text, []string{"*"})); diff != "" {
+			t.Errorf("Wrong spellings of %q, cmp.Diff(want, got):\n%s", testCase.text, diff)
+		}
+	}
+}
+
+func TestPlainEnglishDoesntTagCyrillicAliases(t *testing.T) {
+	router := NewRouter(Config{Chats: []Chat{
+		{ID: 1, Aliases: NewAliases("Asgard")},
+		{ID: 2, Aliases: NewAliases("Рук")},
+	}})
+
+	// "her" is "рук" in the Ukrainian layout, but it isn't a tag.
+	if got := router.Route(1, "Give her a hand at *asgard").ChatIDs(); !cmp.Equal(got, []int64{1}) {
+		t.Errorf("Route() = %v, want [1]", got)
+	}
+}
+
+func TestRouterMatchesOtherSpellings(t *testing.T) {
+	router := NewRouter(Config{Chats: []Chat{
+		{ID: 1, Aliases: NewAliases("Asgard")},
+		{ID: 2, Aliases: NewAliases("Мідгард")},
+		{ID: 3, Aliases: NewAliases("Kharkiv")},
+	}})
+
+	for text, want := range map[string][]int64{
+		"*Асгард":   {1},
+		"*фіпфкв":   {1},
+		"*АСҐАРД":   {1},
+		"*мідгард":  {2},
+		"*midhard":  {2},
+		"*Midgard":  {2},
+		"*vslufhl":  {2},
+		"*харків":   {3},
+		"*ASGARD":   {1},
+		"*гардероб": {},
+	} {
+		if got := router.Route(1, text).ChatIDs(); !cmp.Equal(got, want) {
+			t.Errorf("Route(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestInlineQueriesMatchOtherSpellings(t *testing.T) {
+	bot := &fakeBot{}
+	handler := NewHandler(Config{Chats: []Chat{
+		{ID: 1, Title: "Asgard", Aliases: NewAliases("Asgard")},
+		{ID: 2, Title: "Midgard", Aliases: NewAliases("Мідгард")},
+	}}, bot)
+
+	for query, want := range map[string]string{
+		"*асг":  "*Asgard",
+		"*фіп":  "*Asgard",
+		"*midg": "*Мідгард",
+		"*мід":  "*Мідгард",
+	} {
+		handler.HandleUpdate(tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{Query: query}})
+		var got []string
+		for _, result := range bot.inlineConfig.Results {
+			got = append(got, result.(tgbotapi.InlineQueryResultArticle).Title)
+		}
+		if !cmp.Equal(got, []string{want}) {
+			t.Errorf("Inline query %q suggested %v, want %s", query, got, want)
+		}
+	}
+}
+
+func TestValidateReportsSharedSpellings(t *testing.T) {
+	config := Config{
+		Chats: []Chat{
+			{ID: 1, Aliases: NewAliases("Asgard", "Асгард")},
+			{ID: 2, Aliases: NewAliases("Асґард")},
+		},
+		HelpContacts: []string{"@Odin"},
+	}
+
+	want := Problems{{Path: "chats[1].aliases[0]", Warning: true,
+		Message: `alias "Асґард" is spelled like alias "Asgard" of other chats, so *asgard tags both`}}
+	if diff := cmp.Diff(want, config.Validate()); diff != "" {
+		t.Errorf("Wrong problems, cmp.Diff(want, got):\n%s", diff)
+	}
+}
@@ -0,0 +1,358 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Validate reports problems of a decoded config that JSON decoding can't
+// catch: duplicate chats, malformed aliases, aliases hiding each other,
+// deprecations without a replacement, groups of unknown chats or depending on
+// themselves, malformed or unknown tag prefixes, unknown chats in ACLs and
+// missing help contacts.
+func (config Config) Validate() Problems {
+	var problems Problems
+	if len(config.Chats) == 0 {
+		problems = append(problems, Problem{Path: "chats", Message: "no chats configured"})
+	}
+	if len(config.HelpContacts) == 0 {
+		problems = append(problems, Problem{Path: "help_contacts", Message: "no help contacts, /help would name nobody to ask"})
+	}
+
+	v := validator{chatPaths: make(map[int64]string), aliasPaths: make(map[string]string),
+		aliasChats: make(map[string][]int64), prefixes: make(map[string]bool), tagPrefix: config.Prefixes()[0]}
+	v.tagPrefixes(config.TagPrefixes)
+	for i, chat := range config.Chats {
+		v.chat(chat, indexPath("chats", i))
+	}
+	v.groups(config)
+	problems = append(problems, v.problems...)
+	problems = append(problems, v.unknownACLRefs(NewIndex(config))...)
+	problems = append(problems, v.badDeprecations()...)
+	problems = append(problems, v.overlappingAliases()...)
+	problems = append(problems, v.sharedSpellings()...)
+	return problems
+}
+
+type validator struct {
+	problems Problems
+	// chatPaths maps chat IDs to where they are first defined.
+	chatPaths map[int64]string
+	// aliases are the distinct aliases in the order of their first use,
+	// aliasPaths maps them lowercased to that use.
+	aliases    []string
+	aliasPaths map[string]string
+	// aliasChats maps lowercased aliases to the IDs of their chats.
+	aliasChats map[string][]int64
+	// aclRefs are the AcceptFrom items with their paths.
+	aclRefs []aclRef
+	// deprecations are the deprecated aliases with the paths of their
+	// deprecated_by.
+	deprecations []deprecation
+	// prefixes are the tag prefixes of the config, tagPrefix is the first
+	// one, which problems write tags with.
+	prefixes  map[string]bool
+	tagPrefix string
+}
+
+type deprecation struct {
+	path  string
+	alias Alias
+}
+
+type aclRef struct {
+	path, ref string
+}
+
+func (v *validator) chat(chat Chat, path string) {
+	switch prev, ok := v.chatPaths[chat.ID]; {
+	case chat.ID == 0:
+		v.problems = append(v.problems, Problem{Path: path, Message: "chat has no id"})
+	case ok:
+		v.problems = append(v.problems, Problem{Path: joinPath(path, "id"),
+			Message: fmt.Sprintf("chat ID %d is already used by %s", chat.ID, prev)})
+	default:
+		v.chatPaths[chat.ID] = path
+	}
+
+	for i, alias := range chat.Aliases {
+		aliasPath := indexPath(joinPath(path, "aliases"), i)
+		if msg := aliasSyntaxProblem(alias.Name); msg != "" {
+			v.problems = append(v.problems, Problem{Path: aliasPath, Message: msg})
+			continue
+		}
+		key := strings.ToLower(alias.Name)
+		if _, ok := v.aliasPaths[key]; !ok {
+			v.aliasPaths[key] = aliasPath
+			v.aliases = append(v.aliases, alias.Name)
+		}
+		v.aliasChats[key] = append(v.aliasChats[key], chat.ID)
+		if alias.DeprecatedBy != "" {
+			v.deprecations = append(v.deprecations, deprecation{path: joinPath(aliasPath, "deprecated_by"), alias: alias})
+		}
+	}
+
+	if chat.TagPrefixes != nil && len(chat.TagPrefixes) == 0 {
+		v.problems = append(v.problems, Problem{Path: joinPath(path, "tag_prefixes"),
+			Message: "no tag prefixes, leave tag_prefixes out to allow all"})
+	}
+	for i, prefix := range chat.TagPrefixes {
+		if !v.prefixes[prefix] {
+			v.problems = append(v.problems, Problem{Path: indexPath(joinPath(path, "tag_prefixes"), i),
+				Message: fmt.Sprintf("tag prefix %q isn't one of the config's tag_prefixes", prefix)})
+		}
+	}
+
+	for i, ref := range chat.AcceptFrom {
+		v.aclRefs = append(v.aclRefs, aclRef{path: indexPath(joinPath(path, "accept_from"), i), ref: ref})
+	}
+
+	for i, child := range chat.ChildChats {
+		v.chat(child, indexPath(joinPath(path, "child_chats"), i))
+	}
+}
+
+func (v *validator) groups(config Config) {
+	groups := config.groupsByName()
+	groupIDs := config.GroupChatIDs()
+	groupPaths := make(map[string]string)
+	for i, g := range config.Groups {
+		path := indexPath("groups", i)
+		namePath := joinPath(path, "name")
+		key := strings.ToLower(g.Name)
+		switch msg := aliasSyntaxProblem(g.Name); {
+		case msg != "":
+			v.problems = append(v.problems, Problem{Path: namePath, Message: msg})
+		case groupPaths[key] != "":
+			v.problems = append(v.problems, Problem{Path: namePath,
+				Message: fmt.Sprintf("group %q is already defined by %s", g.Name, groupPaths[key])})
+		case v.aliasPaths[key] != "":
+			v.problems = append(v.problems, Problem{Path: namePath,
+				Message: fmt.Sprintf("group %q is named like the alias at %s", g.Name, v.aliasPaths[key])})
+		default:
+			groupPaths[key] = path
+			v.aliasPaths[key] = namePath
+			v.aliases = append(v.aliases, g.Name)
+			v.aliasChats[key] = groupIDs[key]
+		}
+
+		v.groupChats(joinPath(path, "chats"), g.Chats)
+		v.groupChats(joinPath(path, "subtrees"), g.Subtrees)
+		v.groupRefs(groups, joinPath(path, "union"), g.Union)
+		v.groupRefs(groups, joinPath(path, "difference"), g.Difference)
+		if groupPaths[key] != path {
+			continue
+		}
+		if cycle := groupCycle(groups, g.Name); cycle != nil {
+			v.problems = append(v.problems, Problem{Path: path,
+				Message: fmt.Sprintf("group %q depends on itself: %s", g.Name, strings.Join(cycle, " → "))})
+		} else if len(groupIDs[key]) == 0 {
+			v.problems = append(v.problems, Problem{Path: path, Warning: true,
+				Message: fmt.Sprintf("group %q has no chats", g.Name)})
+		}
+	}
+}
+
+// groupChats reports chat IDs of a group that aren't in the config.
+func (v *validator) groupChats(path string, ids []int64) {
+	for i, id := range ids {
+		if _, ok := v.chatPaths[id]; !ok {
+			v.problems = append(v.problems, Problem{Path: indexPath(path, i), Message: fmt.Sprintf("no chat with ID %d", id)})
+		}
+	}
+}
+
+// groupRefs reports names of groups a group is defined by that aren't in the
+// config.
+func (v *validator) groupRefs(groups map[string]Group, path string, refs []string) {
+	for i, ref := range refs {
+		if _, ok := groups[groupKey(ref)]; !ok {
+			v.problems = append(v.problems, Problem{Path: indexPath(path, i), Message: fmt.Sprintf("no group %q", ref)})
+		}
+	}
+}
+
+// tagPrefixes checks the tag prefixes of the config. A prefix can't have
+// characters aliases or tags consist of.
+func (v *validator) tagPrefixes(prefixes []string) {
+	if len(prefixes) == 0 {
+		v.prefixes[DefaultTagPrefix] = true
+	}
+	for i, prefix := range prefixes {
+		path := indexPath("tag_prefixes", i)
+		switch {
+		case prefix == "":
+			v.problems = append(v.problems, Problem{Path: path, Message: "empty tag prefix"})
+		case strings.IndexFunc(prefix, func(r rune) bool {
+			return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) || strings.ContainsRune(`_-'’"“”«»`, r)
+		}) >= 0:
+			v.problems = append(v.problems, Problem{Path: path,
+				Message: fmt.Sprintf("tag prefix %q may only have symbols and punctuation other than quotes, \"_\" and \"-\"", prefix)})
+		case v.prefixes[prefix]:
+			v.problems = append(v.problems, Problem{Path: path, Message: fmt.Sprintf("tag prefix %q is listed twice", prefix)})
+		default:
+			v.prefixes[prefix] = true
+		}
+	}
+}
+
+func aliasSyntaxProblem(alias string) string {
+	switch {
+	case alias == "":
+		return "empty alias"
+	case strings.Join(strings.Fields(alias), " ") != alias:
+		return fmt.Sprintf("alias %q may only have single spaces between words", alias)
+	case strings.Contains(alias, "*"):
+		return fmt.Sprintf("alias %q contains \"*\"", alias)
+	case strings.ContainsAny(alias, `"“”«»`):
+		return fmt.Sprintf("alias %q contains quotes", alias)
+	}
+	return ""
+}
+
+// unknownACLRefs reports AcceptFrom items that match no chat, which would
+// silently keep chats from forwarding.
+func (v *validator) unknownACLRefs(ix *Index) Problems {
+	var problems Problems
+	for _, r := range v.aclRefs {
+		if _, ok := ix.ChatsByRef(r.ref); ok {
+			continue
+		}
+		problems = append(problems, Problem{Path: r.path, Message: fmt.Sprintf("no chat with ID or alias %q", r.ref)})
+	}
+	return problems
+}
+
+// badDeprecations reports deprecated aliases that don't point to an alias to
+// use instead: an unknown one, themselves or another deprecated one, which
+// also catches cycles.
+func (v *validator) badDeprecations() Problems {
+	deprecatedBy := make(map[string]string)
+	for _, d := range v.deprecations {
+		deprecatedBy[strings.ToLower(d.alias.Name)] = d.alias.DeprecatedBy
+	}
+	var problems Problems
+	for _, d := range v.deprecations {
+		by := strings.TrimPrefix(d.alias.DeprecatedBy, "*")
+		var msg string
+		switch next, deprecated := deprecatedBy[strings.ToLower(by)]; {
+		case strings.EqualFold(by, d.alias.Name):
+			msg = fmt.Sprintf("alias %q is deprecated by itself", d.alias.Name)
+		case v.aliasPaths[strings.ToLower(by)] == "":
+			msg = fmt.Sprintf("alias %q is deprecated by %q, which is no alias", d.alias.Name, by)
+		case deprecated:
+			msg = fmt.Sprintf("alias %q is deprecated by %q, which is deprecated by %q too", d.alias.Name, by, next)
+		default:
+			continue
+		}
+		problems = append(problems, Problem{Path: d.path, Message: msg})
+	}
+	return problems
+}
+
+// overlappingAliases reports aliases contained in other aliases. Tags are
+// found by substring, so an alias that is a prefix of another one is tagged
+// along with it, which is an error. Other overlaps are only confusing.
+func (v *validator) overlappingAliases() Problems {
+	var problems Problems
+	for _, o := range aliasOverlaps(v.aliases) {
+		path := v.aliasPaths[strings.ToLower(o.Long)]
+		if o.Prefix {
+			problems = append(problems, Problem{Path: path,
+				Message: fmt.Sprintf("alias %q starts with alias %q, so %s also tags %s", o.Long, o.Short, TagWith(v.tagPrefix, o.Long), TagWith(v.tagPrefix, o.Short))})
+			continue
+		}
+		problems = append(problems, Problem{Path: path, Warning: true,
+			Message: fmt.Sprintf("alias %q contains alias %q", o.Long, o.Short)})
+	}
+	return problems
+}
+
+// sharedSpellings reports different aliases of different chats that are
+// spelled the same once transliterated, like Asgard and Асгард. A tag in
+// that spelling reaches the chats of both.
+func (v *validator) sharedSpellings() Problems {
+	var problems Problems
+	first := make(map[string]string)
+	for _, alias := range v.aliases {
+		key := strings.ToLower(alias)
+		reported := make(map[string]bool)
+		for _, spelling := range aliasSpellings(key) {
+			other, ok := first[spelling]
+			if !ok {
+				first[spelling] = alias
+				continue
+			}
+			otherKey := strings.ToLower(other)
+			if reported[otherKey] || int64SetEqual(v.aliasChats[key], v.aliasChats[otherKey]) {
+				continue
+			}
+			reported[otherKey] = true
+			problems = append(problems, Problem{Path: v.aliasPaths[key], Warning: true,
+				Message: fmt.Sprintf("alias %q is spelled like alias %q of other chats, so %s tags both", alias, other, TagWith(v.tagPrefix, spelling))})
+		}
+	}
+	return problems
+}
+
+func int64SetEqual(a, b []int64) bool {
+	return len(int64SetDiff(a, b)) == 0 && len(int64SetDiff(b, a)) == 0
+}
+
+// AliasOverlap is a pair of aliases one of which contains the other.
+type AliasOverlap struct {
+	Long  string `json:"alias"`
+	Short string `json:"contains"`
+	// Prefix is set if Long starts with Short, so tagging Long tags Short too.
+	Prefix bool `json:"prefix"`
+}
+
+// aliasOverlaps finds the overlapping pairs among distinct aliases, in one
+// pass over every alias looking for all the others.
+func aliasOverlaps(aliases []string) []AliasOverlap {
+	var keys []string
+	byKey := make(map[string][]int)
+	for i, alias := range aliases {
+		key := strings.ToLower(alias)
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], i)
+	}
+
+	type pair struct{ short, long int }
+	prefix := make(map[pair]bool)
+	var pairs []pair
+	matcher := newAhoCorasick(keys)
+	for _, longKey := range keys {
+		matcher.match(longKey, func(pattern, end int) {
+			shortKey := keys[pattern]
+			if shortKey == longKey {
+				return
+			}
+			for _, short := range byKey[shortKey] {
+				for _, long := range byKey[longKey] {
+					p := pair{short: short, long: long}
+					if _, ok := prefix[p]; !ok {
+						pairs = append(pairs, p)
+					}
+					prefix[p] = prefix[p] || end == len(shortKey)
+				}
+			}
+		})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].short != pairs[j].short {
+			return pairs[i].short < pairs[j].short
+		}
+		return pairs[i].long < pairs[j].long
+	})
+
+	var overlaps []AliasOverlap
+	for _, p := range pairs {
+		overlaps = append(overlaps, AliasOverlap{Long: aliases[p.long], Short: aliases[p.short], Prefix: prefix[p]})
+	}
+	return overlaps
+}
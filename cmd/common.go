@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/bot"
+	"github.com/DzyubSpirit/reTGanslatorBot/configsource"
+	"github.com/DzyubSpirit/reTGanslatorBot/logging"
+	"github.com/DzyubSpirit/reTGanslatorBot/server"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// commonFlags are the flags every command that works with the config shares.
+type commonFlags struct {
+	configSource string
+	logLevel     string
+	storePath    string
+}
+
+func addCommonFlags(fs *flag.FlagSet) *commonFlags {
+	var c commonFlags
+	configSource := os.Getenv("CONFIG_SOURCE")
+	if configSource == "" {
+		configSource = "config.json"
+	}
+	fs.StringVar(&c.configSource, "config", configSource,
+		`config file (.json, .yaml or .toml), "env:NAME" of a variable with JSON or base64, http(s) URL, or comma-separated layers of them`)
+	fs.StringVar(&c.logLevel, "log-level", os.Getenv("LOG_LEVEL"), "debug, info, warn or error; overrides the config")
+	fs.StringVar(&c.storePath, "store", os.Getenv("STORE_PATH"), "file to keep the bot state in, memory if empty")
+	return &c
+}
+
+func (c commonFlags) source() (configsource.Source, error) {
+	return configsource.Parse(c.configSource)
+}
+
+// configName describes the config source in messages without its secrets.
+func (c commonFlags) configName() string {
+	src, err := c.source()
+	if err != nil {
+		return "config"
+	}
+	return src.String()
+}
+
+// loadConfig reads and validates the config, logging its warnings.
+func (c commonFlags) loadConfig() (bot.Config, error) {
+	src, err := c.source()
+	if err != nil {
+		return bot.Config{}, err
+	}
+	data, err := src.Load()
+	if err != nil {
+		return bot.Config{}, err
+	}
+	return c.checkConfig(data, configsource.FormatOf(src))
+}
+
+// checkConfig parses and validates a loaded config, logging its warnings.
+func (c commonFlags) checkConfig(data []byte, format bot.Format) (bot.Config, error) {
+	config, problems := bot.ParseConfigAs(data, format)
+	for _, p := range problems.Warnings() {
+		logging.Default().Warn("Config problem", "source", c.configName(), "problem", p.String())
+	}
+	return config, problems.Err()
+}
+
+// parseConfig returns all problems of the config. The error is only about
+// loading it.
+func (c commonFlags) parseConfig() (bot.Config, bot.Problems, error) {
+	src, err := c.source()
+	if err != nil {
+		return bot.Config{}, nil, err
+	}
+	data, err := src.Load()
+	if err != nil {
+		return bot.Config{}, nil, err
+	}
+	config, problems := bot.ParseConfigAs(data, configsource.FormatOf(src))
+	return config, problems, nil
+}
+
+func newBotAPI() (*tgbotapi.BotAPI, error) {
+	botToken := os.Getenv("BOT_TOKEN")
+	if botToken == "" {
+		return nil, errors.New("BOT_TOKEN has to be specified")
+	}
+	return tgbotapi.NewBotAPI(botToken)
+}
+
+// setup sets up the bot the polling and the webhook modes run.
+func (c commonFlags) setup(opts ...bot.Option) *server.App {
+	a, err := server.NewApp(server.AppConfig{
+		ConfigSource: c.configSource,
+		LogLevel:     c.logLevel,
+		StorePath:    c.storePath,
+		BotToken:     os.Getenv("BOT_TOKEN"),
+		Options:      opts,
+	})
+	if err != nil {
+		logging.Default().Fatal("Failed to set up the bot", "error", err)
+	}
+	return a
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/bot"
+	"github.com/DzyubSpirit/reTGanslatorBot/configsource"
+)
+
+func runValidateConfig(args []string) error {
+	fs := newFlagSet("validate-config")
+	common := addCommonFlags(fs)
+	fs.Parse(args)
+
+	config, problems, err := common.parseConfig()
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		if p.Pos.IsValid() {
+			fmt.Printf("%s:%s\n", common.configName(), p)
+		} else {
+			fmt.Printf("%s: %s\n", common.configName(), p)
+		}
+	}
+	if err := problems.Err(); err != nil {
+		return fmt.Errorf("%s is invalid", common.configName())
+	}
+	fmt.Printf("%s is valid: %d chats, %d tags\n", common.configName(), len(config.AllChats()), len(config.AllAliases()))
+	return nil
+}
+
+func runPrintTags(args []string) error {
+	fs := newFlagSet("print-tags")
+	common := addCommonFlags(fs)
+	fs.Parse(args)
+
+	config, err := common.loadConfig()
+	if err != nil {
+		return fmt.Errorf("%s: %w", common.configName(), err)
+	}
+	for _, alias := range config.AllAliases() {
+		fmt.Println(bot.TagWith(config.Prefixes()[0], strings.ToLower(alias)))
+	}
+	return nil
+}
+
+func runTree(args []string) error {
+	fs := newFlagSet("tree")
+	common := addCommonFlags(fs)
+	format := fs.String("format", "text", "text, dot or mermaid")
+	fs.Parse(args)
+
+	config, err := common.loadConfig()
+	if err != nil {
+		return fmt.Errorf("%s: %w", common.configName(), err)
+	}
+	switch *format {
+	case "text":
+		fmt.Print(config.TextTree())
+	case "dot":
+		fmt.Print(config.DOT())
+	case "mermaid":
+		fmt.Print(config.Mermaid())
+	default:
+		return fmt.Errorf("unknown format %q, expected text, dot or mermaid", *format)
+	}
+	return nil
+}
+
+func runMigrateConfig(args []string) error {
+	fs := newFlagSet("migrate-config")
+	common := addCommonFlags(fs)
+	write := fs.Bool("write", false, "rewrite the config file instead of printing the result")
+	fs.Parse(args)
+
+	src, err := common.source()
+	if err != nil {
+		return err
+	}
+	data, err := src.Load()
+	if err != nil {
+		return err
+	}
+	migrated, from, err := bot.MigrateConfig(data, configsource.FormatOf(src))
+	if err != nil {
+		return fmt.Errorf("%s: %w", src, err)
+	}
+	if !*write {
+		_, err := os.Stdout.Write(migrated)
+		return err
+	}
+	file, ok := src.(configsource.File)
+	if !ok {
+		return fmt.Errorf("-write needs a config file, %s isn't one", src)
+	}
+	if from == bot.CurrentConfigVersion {
+		fmt.Fprintf(os.Stderr, "%s is already at version %d\n", file.Path, from)
+		return nil
+	}
+	info, err := os.Stat(file.Path)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(file.Path, migrated, info.Mode()); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s migrated from version %d to %d\n", file.Path, from, bot.CurrentConfigVersion)
+	return nil
+}
+
+func runConvertConfig(args []string) error {
+	fs := newFlagSet("convert-config")
+	common := addCommonFlags(fs)
+	to := fs.String("to", "", "json, yaml or toml; the extension of -o by default")
+	out := fs.String("o", "", "file to write, stdout if empty")
+	fs.Parse(args)
+
+	if *to == "" && *out != "" {
+		*to = string(bot.FormatOf(*out))
+	}
+	format, err := bot.ParseFormat(*to)
+	if err != nil {
+		return err
+	}
+	src, err := common.source()
+	if err != nil {
+		return err
+	}
+	data, err := src.Load()
+	if err != nil {
+		return err
+	}
+	converted, err := bot.ConvertConfig(data, configsource.FormatOf(src), format)
+	if err != nil {
+		return fmt.Errorf("%s: %w", src, err)
+	}
+	if *out == "" {
+		_, err := os.Stdout.Write(converted)
+		return err
+	}
+	return ioutil.WriteFile(*out, converted, 0o644)
+}
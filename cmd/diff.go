@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/bot"
+	"github.com/DzyubSpirit/reTGanslatorBot/configsource"
+)
+
+// configCommands are the subcommands of "retg config". The config commands
+// with a "-config" suffix are kept as they are for scripts.
+var configCommands = map[string]func(args []string) error{
+	"diff":     runConfigDiff,
+	"validate": runValidateConfig,
+	"migrate":  runMigrateConfig,
+	"convert":  runConvertConfig,
+	"tree":     runTree,
+}
+
+func runConfig(args []string) error {
+	var names []string
+	for name := range configCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(args) == 0 {
+		return fmt.Errorf("expected a subcommand: %s", strings.Join(names, ", "))
+	}
+	run, ok := configCommands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown subcommand %q, expected one of %s", args[0], strings.Join(names, ", "))
+	}
+	return run(args[1:])
+}
+
+func runConfigDiff(args []string) error {
+	fs := newFlagSet("config diff")
+	asJSON := fs.Bool("json", false, "print the diff as JSON")
+	exitCode := fs.Bool("exit-code", false, "exit with status 1 if routing changes")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: retg config diff [flags] <old config> <new config>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected two configs")
+	}
+
+	old, err := loadConfigSource(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	new, err := loadConfigSource(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	diff := bot.DiffConfigs(old, new)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diff); err != nil {
+			return err
+		}
+	} else {
+		fmt.Print(diff)
+	}
+	if *exitCode && !diff.Empty() {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// loadConfigSource loads a config given by a source spec. Problems found by
+// validation are printed, the diff shows what changed about them.
+func loadConfigSource(spec string) (bot.Config, error) {
+	src, err := configsource.Parse(spec)
+	if err != nil {
+		return bot.Config{}, err
+	}
+	data, err := src.Load()
+	if err != nil {
+		return bot.Config{}, fmt.Errorf("%s: %w", src, err)
+	}
+	config, problems := bot.ParseConfigAs(data, configsource.FormatOf(src))
+	// ParseConfigAs returns the zero Config if the document can't be decoded.
+	if err := problems.Err(); err != nil && reflect.DeepEqual(config, bot.Config{}) {
+		return bot.Config{}, fmt.Errorf("%s: %w", src, err)
+	}
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", src, p)
+	}
+	return config, nil
+}
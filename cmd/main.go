@@ -1,55 +1,83 @@
+// Command retg runs the reTGanslator bot and the tools around it.
+//
+// Usage:
+//
+//	retg <command> [flags]
+//
+// Run "retg help" for the list of commands.
 package main
 
 import (
-	"encoding/json"
-	"io/ioutil"
-	"log"
+	"flag"
+	"fmt"
 	"os"
+	"strings"
 
-	"github.com/DzyubSpirit/reTGanslatorBot/bot"
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/DzyubSpirit/reTGanslatorBot/logging"
 )
 
-func main() {
-	botToken := os.Getenv("BOT_TOKEN")
-	if botToken == "" {
-		log.Fatalf("BOT_TOKEN has to be specified")
-	}
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
 
-	configFile, err := os.Open("./config.json")
-	if err != nil {
-		log.Fatalf("Failed to open config.json: %v", err)
-	}
+var commands []command
 
-	configBytes, err := ioutil.ReadAll(configFile)
-	if err != nil {
-		log.Fatalf("Failed to read config.json: %v", err)
+func init() {
+	commands = []command{
+		{"poll", "handle updates by long polling the Bot API", runPoll},
+		{"serve", "handle updates on a self-hosted webhook", runServe},
+		{"set-webhook", "register the webhook with Telegram", runSetWebhook},
+		{"delete-webhook", "unregister the webhook to poll again", runDeleteWebhook},
+		{"webhook-info", "print the webhook status reported by Telegram", runWebhookInfo},
+		{"config", "work with configs: diff, validate, migrate, convert, tree", runConfig},
+		{"validate-config", "check the config and report all problems", runValidateConfig},
+		{"tree", "render the chat tree as text, Graphviz DOT or Mermaid", runTree},
+		{"migrate-config", "upgrade the config file to the current version", runMigrateConfig},
+		{"convert-config", "translate the config between JSON, YAML and TOML", runConvertConfig},
+		{"simulate", "show what the bot would do with a message", runSimulate},
+		{"print-tags", "print all tags of the config", runPrintTags},
 	}
+}
 
-	var config bot.Config
-	if err = json.Unmarshal(configBytes, &config); err != nil {
-		log.Fatalf("Failed to parse config.json: %v", err)
+func main() {
+	name := "poll"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
-
-	tgBot, err := tgbotapi.NewBotAPI(botToken)
-	if err != nil {
-		log.Fatalf("Bot API failed to initialize: %v", err)
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
 	}
 
-	botHandler := bot.NewHandler(config, tgBot)
-
-	tgBot.Debug = true
-
-	log.Printf("Authorized on account %s", tgBot.Self.UserName)
-
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-
-	updates, err := tgBot.GetUpdatesChan(u)
-	for update := range updates {
-		err := botHandler.HandleUpdate(update)
-		if err != nil {
-			log.Printf("Handle incoming update: %v", err)
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(args); err != nil {
+				fmt.Fprintf(os.Stderr, "retg %s: %v\n", name, logging.RedactError(err))
+				os.Exit(1)
+			}
+			return
 		}
 	}
+	fmt.Fprintf(os.Stderr, "retg: unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: retg <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, `Run "retg <command> -h" for the flags of a command.`)
+	fmt.Fprintln(os.Stderr, "The bot token is read from BOT_TOKEN.")
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet("retg "+name, flag.ExitOnError)
 }
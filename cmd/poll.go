@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/bot"
+	"github.com/DzyubSpirit/reTGanslatorBot/logging"
+	"github.com/DzyubSpirit/reTGanslatorBot/metrics"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func runPoll(args []string) error {
+	fs := newFlagSet("poll")
+	common := addCommonFlags(fs)
+	reload := addReloadFlags(fs)
+	metricsAddr := fs.String("metrics-addr", os.Getenv("METRICS_ADDR"), `serve /metrics on this address, e.g. ":9090"; off if empty`)
+	workers := fs.Int("workers", 1, "number of updates handled at once; with more than 1 messages may be forwarded out of order")
+	fs.Parse(args)
+	if *workers < 1 {
+		return fmt.Errorf("-workers has to be at least 1, got %d", *workers)
+	}
+
+	var opts []bot.Option
+	var metricsHandler http.Handler
+	if *metricsAddr != "" {
+		m := metrics.NewPrometheus()
+		opts = append(opts, bot.WithMetrics(m))
+		metricsHandler = m.Handler()
+	}
+
+	a := common.setup(opts...)
+	if metricsHandler != nil {
+		go serveMetrics(a.Log, *metricsAddr, metricsHandler)
+	}
+	r, err := common.newReloader(reload, a)
+	if err != nil {
+		return err
+	}
+	go r.run(context.Background())
+
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 60
+
+	updates, err := a.BotAPI.GetUpdatesChan(u)
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for update := range updates {
+				err := a.Handler.HandleUpdate(update)
+				if err != nil {
+					a.Log.Error("Handle incoming update", "update_id", update.UpdateID, "error", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+func serveMetrics(log *logging.Logger, addr string, h http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", h)
+	log.Info("Serving metrics", "addr", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Fatal("Metrics listener failed", "error", err)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/bot"
+	"github.com/DzyubSpirit/reTGanslatorBot/configsource"
+	"github.com/DzyubSpirit/reTGanslatorBot/logging"
+	"github.com/DzyubSpirit/reTGanslatorBot/server"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// reloadFlags configure how a running bot picks up config changes.
+type reloadFlags struct {
+	watch     time.Duration
+	adminChat int64
+}
+
+func addReloadFlags(fs *flag.FlagSet) *reloadFlags {
+	var r reloadFlags
+	adminChat, _ := strconv.ParseInt(os.Getenv("ADMIN_CHAT_ID"), 10, 64)
+	fs.DurationVar(&r.watch, "watch", 10*time.Second, "check the config for changes this often; 0 reloads only on SIGHUP")
+	fs.Int64Var(&r.adminChat, "admin-chat", adminChat, "chat to announce config reloads to; off if 0")
+	return &r
+}
+
+// reloader swaps the config of a running Handler when the config changes or
+// on SIGHUP. A config with errors is rejected and the old one stays active.
+type reloader struct {
+	common  *commonFlags
+	flags   *reloadFlags
+	source  configsource.Source
+	handler *bot.Handler
+	bot     bot.BotAPI
+	log     *logging.Logger
+	// last is the document checked last, valid or not.
+	last []byte
+}
+
+func (c *commonFlags) newReloader(flags *reloadFlags, a *server.App) (*reloader, error) {
+	src, err := c.source()
+	if err != nil {
+		return nil, err
+	}
+	r := &reloader{common: c, flags: flags, source: src, handler: a.Handler, bot: a.BotAPI, log: a.Log}
+	r.last, _ = src.Load()
+	return r, nil
+}
+
+// run reloads the config until ctx is done.
+func (r *reloader) run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if r.flags.watch > 0 {
+		ticker := time.NewTicker(r.flags.watch)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.check("sighup", true)
+		case <-tick:
+			r.check("changed", false)
+		}
+	}
+}
+
+// check loads the config and reloads it if it changed or force is set.
+func (r *reloader) check(trigger string, force bool) {
+	log := r.log.With("trigger", trigger, "source", r.source.String())
+	data, err := r.source.Load()
+	if err != nil {
+		log.Warn("Failed to load the config for reload", "error", err)
+		return
+	}
+	if !force && bytes.Equal(data, r.last) {
+		return
+	}
+	r.last = data
+
+	config, err := r.common.checkConfig(data, configsource.FormatOf(r.source))
+	if err != nil {
+		log.Error("Config reload failed, keeping the previous config", "error", err)
+		r.announce(log, fmt.Sprintf("Config reload failed, the previous config stays active:\n%v", err))
+		return
+	}
+
+	r.handler.SetConfig(config)
+	if r.common.logLevel == "" {
+		if level, err := logging.ParseLevel(config.Logging.Level); err == nil {
+			r.log.SetLevel(level)
+		}
+	}
+	chats, tags := len(config.AllChats()), len(config.AllAliases())
+	log.Info("Config reloaded", "chats", chats, "tags", tags)
+	r.announce(log, fmt.Sprintf("Config reloaded: %d chats, %d tags", chats, tags))
+}
+
+func (r *reloader) announce(log *logging.Logger, text string) {
+	if r.flags.adminChat == 0 {
+		return
+	}
+	if _, err := r.bot.Send(tgbotapi.NewMessage(r.flags.adminChat, text)); err != nil {
+		log.Warn("Failed to announce the config reload", "admin_chat_id", r.flags.adminChat, "error", logging.RedactError(err))
+	}
+}
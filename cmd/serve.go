@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/bot"
+	"github.com/DzyubSpirit/reTGanslatorBot/metrics"
+	"github.com/DzyubSpirit/reTGanslatorBot/server"
+)
+
+// runServe runs the webhook Server on a plain net/http listener and registers
+// it with Telegram, so the bot runs on any VM or container.
+func runServe(args []string) error {
+	fs := newFlagSet("serve")
+	common := addCommonFlags(fs)
+	reload := addReloadFlags(fs)
+	listen := fs.String("listen", ":8080", "address to listen on")
+	publicURL := fs.String("public-url", os.Getenv("PUBLIC_URL"), "URL the listener is reachable at from the internet, e.g. https://bot.example.com")
+	tlsCert := fs.String("tls-cert", "", "TLS certificate file, serves plain HTTP if empty")
+	tlsKey := fs.String("tls-key", "", "TLS private key file")
+	selfSigned := fs.Bool("self-signed", false, "upload -tls-cert to Telegram because it's self-signed")
+	register := fs.Bool("set-webhook", true, "register the webhook with Telegram on startup")
+	deleteOnExit := fs.Bool("delete-webhook", false, "delete the webhook on shutdown")
+	fs.Parse(args)
+
+	m := metrics.NewPrometheus()
+	a := common.setup(bot.WithMetrics(m))
+	log := a.Log
+
+	token := os.Getenv("WEBHOOK_TOKEN")
+	if token == "" {
+		token = randomToken()
+	}
+
+	srv := server.NewWebhook(a, token, os.Getenv("DEBUG_TOKEN"), m.Handler())
+	httpSrv := &http.Server{Addr: *listen, Handler: srv}
+
+	go func() {
+		log.Info("Listening for updates", "addr", *listen, "tls", *tlsCert != "")
+		var err error
+		if *tlsCert != "" {
+			err = httpSrv.ListenAndServeTLS(*tlsCert, *tlsKey)
+		} else {
+			err = httpSrv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Listener failed", "error", err)
+		}
+	}()
+
+	if *register {
+		if *publicURL == "" {
+			return errors.New("-public-url or PUBLIC_URL has to be specified to set the webhook")
+		}
+		wh := server.Webhook{BaseURL: *publicURL, Token: token}
+		if *selfSigned {
+			wh.Certificate = *tlsCert
+		}
+		if err := server.SetWebhook(a.BotAPI, wh); err != nil {
+			return err
+		}
+		log.Info("Webhook set", "allowed_updates", bot.AllowedUpdates)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	r, err := common.newReloader(reload, a)
+	if err != nil {
+		return err
+	}
+	go r.run(ctx)
+	<-ctx.Done()
+
+	log.Info("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := httpSrv.Shutdown(shutdownCtx); err != nil {
+		log.Error("Failed to shut down the listener", "error", err)
+	}
+	if *deleteOnExit {
+		if err := server.DeleteWebhook(a.BotAPI, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
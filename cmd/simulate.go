@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/bot"
+)
+
+func runSimulate(args []string) error {
+	fs := newFlagSet("simulate")
+	common := addCommonFlags(fs)
+	from := fs.String("from", "", "ID or alias of the chat the message is sent to")
+	text := fs.String("text", "", "text of the message")
+	caption := fs.String("caption", "", "caption of the message")
+	fs.Parse(args)
+
+	if *from == "" {
+		return errors.New("-from has to be specified")
+	}
+	config, err := common.loadConfig()
+	if err != nil {
+		return fmt.Errorf("%s: %w", common.configName(), err)
+	}
+	// Unknown chat IDs are fine, they show how messages from outside are routed.
+	router := bot.NewRouter(config)
+	fromID, err := strconv.ParseInt(*from, 10, 64)
+	if err != nil {
+		ids, _ := router.Index().ChatsByRef(*from)
+		switch len(ids) {
+		case 0:
+			return fmt.Errorf("no chat with alias %q in %s", *from, common.configName())
+		case 1:
+			fromID = ids[0]
+		default:
+			chats := make([]string, len(ids))
+			for i, id := range ids {
+				chats[i] = strconv.FormatInt(id, 10)
+			}
+			return fmt.Errorf("alias %q is shared by chats %s in %s, specify the chat ID as -from",
+				*from, strings.Join(chats, ", "), common.configName())
+		}
+	}
+
+	plan := router.Route(fromID, *text, *caption)
+	printPlan(os.Stdout, router.Index(), plan)
+	return nil
+}
+
+// printPlan prints where a message goes, with the tags written as in the chat
+// it's sent to.
+func printPlan(w io.Writer, ix *bot.Index, plan bot.Plan) {
+	if len(plan.Deliveries) == 0 {
+		fmt.Fprintf(w, "A message from chat %d goes nowhere\n", plan.FromChatID)
+	} else {
+		fmt.Fprintf(w, "A message from chat %d goes to:\n", plan.FromChatID)
+		for _, d := range plan.Deliveries {
+			tags := make([]string, len(d.Aliases))
+			for i, alias := range d.Aliases {
+				tags[i] = ix.ChatTag(plan.FromChatID, alias)
+			}
+			fmt.Fprintf(w, "  chat %d via %s\n", d.ChatID, strings.Join(tags, ", "))
+			if !d.Modifiers.IsZero() {
+				fmt.Fprintf(w, "    modifiers: %s\n", bot.DescribeModifiers(d.Modifiers))
+			}
+		}
+	}
+	if len(plan.Rules) > 0 {
+		fmt.Fprintln(w, "Rules applied:")
+		for _, rule := range plan.Rules {
+			fmt.Fprintf(w, "  %s\n", rule)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/server"
+)
+
+func runSetWebhook(args []string) error {
+	fs := newFlagSet("set-webhook")
+	publicURL := fs.String("public-url", os.Getenv("PUBLIC_URL"), "URL the webhook is reachable at, without the /webhook/<token> path")
+	token := fs.String("token", os.Getenv("WEBHOOK_TOKEN"), "secret token of the webhook path")
+	certificate := fs.String("certificate", "", "self-signed certificate to upload")
+	maxConnections := fs.Int("max-connections", 0, "maximum simultaneous update deliveries, Telegram's default if 0")
+	dropPending := fs.Bool("drop-pending-updates", false, "discard updates waiting for delivery")
+	fs.Parse(args)
+
+	if *publicURL == "" || *token == "" {
+		return errors.New("-public-url and -token have to be specified")
+	}
+	tgBot, err := newBotAPI()
+	if err != nil {
+		return err
+	}
+	wh := server.Webhook{
+		BaseURL:            *publicURL,
+		Token:              *token,
+		Certificate:        *certificate,
+		MaxConnections:     *maxConnections,
+		DropPendingUpdates: *dropPending,
+	}
+	if err := server.SetWebhook(tgBot, wh); err != nil {
+		return err
+	}
+	fmt.Println("Webhook set")
+	return nil
+}
+
+func runDeleteWebhook(args []string) error {
+	fs := newFlagSet("delete-webhook")
+	dropPending := fs.Bool("drop-pending-updates", false, "discard updates waiting for delivery")
+	fs.Parse(args)
+
+	tgBot, err := newBotAPI()
+	if err != nil {
+		return err
+	}
+	if err := server.DeleteWebhook(tgBot, *dropPending); err != nil {
+		return err
+	}
+	fmt.Println("Webhook deleted")
+	return nil
+}
+
+func runWebhookInfo(args []string) error {
+	fs := newFlagSet("webhook-info")
+	fs.Parse(args)
+
+	tgBot, err := newBotAPI()
+	if err != nil {
+		return err
+	}
+	info, err := tgBot.GetWebhookInfo()
+	if err != nil {
+		return err
+	}
+	// The registered URL ends with the secret webhook token.
+	if i := strings.Index(info.URL, "/webhook/"); i >= 0 {
+		info.URL = info.URL[:i] + server.WebhookPath("[redacted]")
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(info)
+}
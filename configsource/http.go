@@ -0,0 +1,81 @@
+package configsource
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// HTTP loads the document from a URL. It remembers the ETag of the last
+// response, so loading an unchanged document again costs a 304 response.
+type HTTP struct {
+	URL    string
+	Client *http.Client
+
+	mu   sync.Mutex
+	etag string
+	data []byte
+}
+
+// NewHTTP returns an HTTP source with a client that times out.
+func NewHTTP(url string) *HTTP {
+	return &HTTP{URL: url, Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (h *HTTP) Load() ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	req, err := http.NewRequest(http.MethodGet, h.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if h.etag != "" {
+		req.Header.Set("If-None-Match", h.etag)
+	}
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The error contains the URL, which may carry credentials, so only
+		// its cause is kept.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return nil, fmt.Errorf("GET %s: %w", h, urlErr.Err)
+		}
+		return nil, fmt.Errorf("GET %s failed", h)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if h.data != nil {
+			return h.data, nil
+		}
+	case http.StatusOK:
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("GET %s: %w", h, err)
+		}
+		h.etag, h.data = resp.Header.Get("ETag"), data
+		return data, nil
+	}
+	return nil, fmt.Errorf("GET %s: %s", h, resp.Status)
+}
+
+// String returns the URL without credentials and query, which often holds
+// access tokens.
+func (h *HTTP) String() string {
+	u, err := url.Parse(h.URL)
+	if err != nil {
+		return "invalid URL"
+	}
+	u.User, u.RawQuery, u.Fragment = nil, "", ""
+	return u.String()
+}
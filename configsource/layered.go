@@ -0,0 +1,65 @@
+package configsource
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/bot"
+)
+
+// Layered merges the documents of several sources, e.g. a base config and
+// environment-specific overrides. Layers may be of different formats, the
+// merged document is JSON. Later layers override earlier ones like a
+// JSON merge patch (RFC 7386): objects are merged key by key, a null removes
+// the key, and any other value, lists included, replaces the previous one.
+type Layered []Source
+
+func (l Layered) Load() ([]byte, error) {
+	var merged interface{}
+	for i, layer := range l {
+		data, err := layer.Load()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", layer, err)
+		}
+		doc, err := bot.DecodeDocument(data, FormatOf(layer))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", layer, err)
+		}
+		if i == 0 {
+			merged = doc
+		} else {
+			merged = mergePatch(merged, doc)
+		}
+	}
+	// Problems of the merged config are reported at its lines, so keep it
+	// readable.
+	return json.MarshalIndent(merged, "", "  ")
+}
+
+func (l Layered) String() string {
+	names := make([]string, len(l))
+	for i, layer := range l {
+		names[i] = layer.String()
+	}
+	return strings.Join(names, ",")
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{})
+	}
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+		} else {
+			targetObj[key] = mergePatch(targetObj[key], value)
+		}
+	}
+	return targetObj
+}
@@ -0,0 +1,124 @@
+// Package configsource loads config documents from files, environment
+// variables and HTTP URLs, and layers several of them into one.
+package configsource
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/bot"
+)
+
+// Source loads a config document. Implementations have to be safe for
+// concurrent use.
+type Source interface {
+	// Load returns the current document.
+	Load() ([]byte, error)
+	// String describes the source for logs. It never contains secrets.
+	String() string
+}
+
+// Parse returns the Source described by spec. Layers are separated by commas,
+// later layers override earlier ones, see Layered. A comma inside a layer,
+// like in the query of a URL, is escaped as "\,". A layer is "env:NAME" for
+// an environment variable, an http:// or https:// URL, or a file path,
+// optionally prefixed with "file:".
+func Parse(spec string) (Source, error) {
+	var layers Layered
+	for _, layer := range splitLayers(spec) {
+		layer = strings.TrimSpace(layer)
+		switch {
+		case layer == "":
+			return nil, fmt.Errorf("empty layer in config source %q", spec)
+		case strings.HasPrefix(layer, "env:"):
+			layers = append(layers, Env{Name: strings.TrimPrefix(layer, "env:")})
+		case strings.HasPrefix(layer, "http://"), strings.HasPrefix(layer, "https://"):
+			layers = append(layers, NewHTTP(layer))
+		default:
+			layers = append(layers, File{Path: strings.TrimPrefix(layer, "file:")})
+		}
+	}
+	if len(layers) == 1 {
+		return layers[0], nil
+	}
+	return layers, nil
+}
+
+// splitLayers splits spec at the commas not escaped with a backslash and
+// unescapes the others.
+func splitLayers(spec string) []string {
+	var layers []string
+	var layer strings.Builder
+	for i := 0; i < len(spec); i++ {
+		switch {
+		case strings.HasPrefix(spec[i:], `\,`):
+			layer.WriteByte(',')
+			i++
+		case spec[i] == ',':
+			layers = append(layers, layer.String())
+			layer.Reset()
+		default:
+			layer.WriteByte(spec[i])
+		}
+	}
+	return append(layers, layer.String())
+}
+
+// FormatOf returns the format of the documents src loads. Files and URLs are
+// told by their extension, environment variables hold JSON, and Layered
+// merges its layers into JSON.
+func FormatOf(src Source) bot.Format {
+	switch src := src.(type) {
+	case File:
+		return bot.FormatOf(src.Path)
+	case *HTTP:
+		if u, err := url.Parse(src.URL); err == nil {
+			return bot.FormatOf(u.Path)
+		}
+	}
+	return bot.FormatJSON
+}
+
+// File loads the document from a file.
+type File struct {
+	Path string
+}
+
+func (f File) Load() ([]byte, error) {
+	return ioutil.ReadFile(f.Path)
+}
+
+func (f File) String() string {
+	return f.Path
+}
+
+// Env loads the document from an environment variable. The value is either
+// the JSON itself or its base64 encoding, which survives tools that mangle
+// quotes and newlines.
+type Env struct {
+	Name string
+}
+
+func (e Env) Load() ([]byte, error) {
+	value, ok := os.LookupEnv(e.Name)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s isn't set", e.Name)
+	}
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "{") {
+		return []byte(value), nil
+	}
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("environment variable %s is neither JSON nor base64: %w", e.Name, err)
+	}
+	return data, nil
+}
+
+func (e Env) String() string {
+	return "env:" + e.Name
+}
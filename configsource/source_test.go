@@ -0,0 +1,147 @@
+package configsource
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParse(t *testing.T) {
+	for spec, want := range map[string]string{
+		"config.json":                       "config.json",
+		"file:config.json":                  "config.json",
+		"env:CONFIG_DATA":                   "env:CONFIG_DATA",
+		"https://user:pw@example.com/c?k=1": "https://example.com/c",
+		"base.json, env:OVERRIDES":          "base.json,env:OVERRIDES",
+	} {
+		src, err := Parse(spec)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", spec, err)
+			continue
+		}
+		if got := src.String(); got != want {
+			t.Errorf("Parse(%q).String() = %q, want %q", spec, got, want)
+		}
+	}
+	if _, err := Parse("config.json,"); err == nil {
+		t.Errorf("Expected an error for an empty layer")
+	}
+
+	src, err := Parse(`base.json,https://example.com/c?fields=a\,b`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if layers, ok := src.(Layered); !ok || len(layers) != 2 || layers[1].(*HTTP).URL != "https://example.com/c?fields=a,b" {
+		t.Errorf("Expected an escaped comma to stay in the URL, got %#v", src)
+	}
+}
+
+func TestEnvAcceptsRawAndBase64(t *testing.T) {
+	doc := `{"help_contacts": ["@Karas"]}`
+	for name, value := range map[string]string{
+		"raw":    "\n" + doc,
+		"base64": base64.StdEncoding.EncodeToString([]byte(doc)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			os.Setenv("RETG_TEST_CONFIG", value)
+			defer os.Unsetenv("RETG_TEST_CONFIG")
+
+			data, err := Env{Name: "RETG_TEST_CONFIG"}.Load()
+
+			if err != nil || string(data) != doc {
+				t.Errorf("Load() = %q, %v; want %q", data, err, doc)
+			}
+		})
+	}
+	if _, err := (Env{Name: "RETG_TEST_UNSET"}).Load(); err == nil {
+		t.Errorf("Expected an error for an unset variable")
+	}
+}
+
+func TestHTTPUsesETag(t *testing.T) {
+	var requests, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"chats": []}`))
+	}))
+	defer srv.Close()
+	src := NewHTTP(srv.URL)
+
+	for i := 0; i < 2; i++ {
+		data, err := src.Load()
+		if err != nil || string(data) != `{"chats": []}` {
+			t.Fatalf("Load() #%d = %q, %v", i, data, err)
+		}
+	}
+
+	if requests != 2 || notModified != 1 {
+		t.Errorf("Expected the second request to be conditional, got %d requests and %d 304s", requests, notModified)
+	}
+}
+
+func TestHTTPFailsOnErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	if _, err := NewHTTP(srv.URL).Load(); err == nil {
+		t.Errorf("Expected an error for 404")
+	}
+}
+
+func TestHTTPKeepsTheCauseWithoutCredentials(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	_, err := NewHTTP(srv.URL + "/c.json?token=secret").Load()
+
+	if err == nil || strings.Contains(err.Error(), "secret") || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("Expected the cause of the failure without the query, got %v", err)
+	}
+}
+
+func TestLayeredMergesOverrides(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.json")
+	override := filepath.Join(dir, "prod.json")
+	ioutil.WriteFile(base, []byte(`{
+  "chats": [{"id": 1, "aliases": ["First"]}],
+  "help_contacts": ["@Karas"],
+  "logging": {"level": "debug", "verbose_payloads": true}
+}`), 0o600)
+	ioutil.WriteFile(override, []byte(`{
+  "help_contacts": ["@Valera"],
+  "logging": {"level": "warn", "verbose_payloads": null}
+}`), 0o600)
+
+	data, err := Layered{File{Path: base}, File{Path: override}}.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Merged document isn't valid JSON: %v", err)
+	}
+	want := map[string]interface{}{
+		"chats":         []interface{}{map[string]interface{}{"id": 1.0, "aliases": []interface{}{"First"}}},
+		"help_contacts": []interface{}{"@Valera"},
+		"logging":       map[string]interface{}{"level": "warn"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Wrong merged document, cmp.Diff(want, got):\n%s", diff)
+	}
+}
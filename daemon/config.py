@@ -1,10 +1,11 @@
 import json
-from typing import Iterable, List, Sequence
+from typing import Iterable, List, Sequence, Set
 
 
 class Chat:
     chat_id: int
     aliases: Sequence[str]
+    deprecated_aliases: Set[str]
     members_must_be_in_any_child_chat: bool
     child_chats: Sequence["Chat"]
 
@@ -13,13 +14,37 @@ class Chat:
         self.aliases = aliases
         self.members_must_be_in_any_child_chat = members_must_be_in_any_child_chat
         self.child_chats = child_chats if child_chats else []
+        self.deprecated_aliases = set()
+
+    @property
+    def name(self):
+        """The first alias that isn't deprecated, to name the chat in reports."""
+        for alias in self.aliases:
+            if alias not in self.deprecated_aliases:
+                return alias
+        return self.aliases[0] if self.aliases else str(self.chat_id)
 
     @staticmethod
     def from_json_dict(json_dict):
-        json_dict = json_dict.copy()
-        json_dict["chat_id"] = json_dict["id"]
-        del json_dict["id"]
-        chat = Chat(**json_dict)
+        # Fields only the bot uses, like "title" and "accept_from", are skipped.
+        chat_dict = {
+            key: json_dict[key]
+            for key in ("aliases", "members_must_be_in_any_child_chat", "child_chats")
+            if key in json_dict
+        }
+        chat_dict["chat_id"] = json_dict["id"]
+        # An alias is a name or an object with the name and its metadata.
+        chat_dict["aliases"] = [
+            alias if isinstance(alias, str) else alias["name"]
+            for alias in chat_dict.get("aliases", [])
+        ]
+        deprecated = {
+            alias["name"]
+            for alias in json_dict.get("aliases", [])
+            if not isinstance(alias, str) and alias.get("deprecated_by")
+        }
+        chat = Chat(**chat_dict)
+        chat.deprecated_aliases = deprecated
         chat.child_chats = [
             Chat.from_json_dict(child) for child in chat.child_chats
         ]
@@ -76,19 +101,36 @@ class MembershipValidation:
         return MembershipValidation(**json_dict)
 
 
+# The newest config version this daemon understands. Keep in sync with
+# CurrentConfigVersion in bot/migrate.go; "retg migrate-config" upgrades
+# older files.
+CONFIG_VERSION = 2
+
+
 class Config:
+    version: int
     chats: Sequence[Chat]
     help_contacts: Iterable[str]
     membership_validation: MembershipValidation
 
-    def __init__(self, chats, help_contacts, membership_validation):
+    def __init__(self, chats, help_contacts, membership_validation, version=1):
+        self.version = version
         self.chats = chats
         self.help_contacts = help_contacts
         self.membership_validation = membership_validation
 
     @staticmethod
     def from_json_dict(json_dict):
-        json_dict = json_dict.copy()
+        version = json_dict.get("version", 1)
+        if version > CONFIG_VERSION:
+            raise ValueError(
+                f"config version {version} is newer than the supported version {CONFIG_VERSION}")
+        # Fields only the bot uses, like "logging", are skipped.
+        json_dict = {
+            key: json_dict[key]
+            for key in ("version", "chats", "help_contacts", "membership_validation")
+            if key in json_dict
+        }
         json_dict["chats"] = [
             Chat.from_json_dict(chat) for chat in json_dict["chats"]
         ]
@@ -118,14 +118,14 @@ def format_missing(
 
         for missing_chat_id, present_chat_ids in chats.items():
             present_str = ", ".join([
-                f'"{chat_per_id[chat_id].aliases[0]}"'
+                f'"{chat_per_id[chat_id].name}"'
                 for chat_id in present_chat_ids
             ])
             if missing_chat_id == "child chats":
                 res += f"\t - child chats of {present_str}\n"
             else:
                 res += (
-                    f'\t - "{chat_per_id[missing_chat_id].aliases[0]}" even though '
+                    f'\t - "{chat_per_id[missing_chat_id].name}" even though '
                     f"they are in {present_str}\n")
 
     return res
@@ -112,5 +112,21 @@ class Test_find_missing_in_children(unittest.TestCase):
         self.assertEqual(want_missing, list(got_missing))
 
 
+class Test_Chat_from_json_dict(unittest.TestCase):
+
+    def test_aliases_with_metadata(self):
+        chat = Chat.from_json_dict({
+            "id": 123,
+            "aliases": [
+                {"name": "Old", "deprecated_by": "New"},
+                {"name": "New", "description": "The new name"},
+                "Plain",
+            ],
+        })
+        self.assertEqual(chat.aliases, ["Old", "New", "Plain"])
+        self.assertEqual(chat.name, "New",
+                         "Should name the chat by its first alias that isn't deprecated")
+
+
 if __name__ == "__main__":
     unittest.main()
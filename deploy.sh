@@ -6,24 +6,27 @@ BOT_TOKEN=${BOT_TOKEN:?"BOT_TOKEN must be specified"}
 WEBHOOK_FUNC_NAME=${WEBHOOK_FUNC_NAME:-"tg-webhook-updates"}
 WEBHOOK_FUNC_REGION=${WEBHOOK_FUNC_REGION:-"europe-west2"}
 WEBHOOK_TOKEN=${WEBHOOK_TOKEN:-$(openssl rand -hex 64)}
+export BOT_TOKEN
 
-curl -X POST -F "drop_pending_updates=True" https://api.telegram.org/bot"${BOT_TOKEN}"/deleteWebhook \
-; echo
+# The config is deployed with the sources unless CONFIG_DATA holds it. It's
+# passed base64-encoded because --set-env-vars splits values at commas.
+ENV_VARS="BOT_TOKEN=${BOT_TOKEN},WEBHOOK_TOKEN=${WEBHOOK_TOKEN},RUN_LOCAL=false"
+if [ -n "${CONFIG_DATA}" ]; then
+  ENV_VARS="${ENV_VARS},CONFIG_SOURCE=env:CONFIG_DATA,CONFIG_DATA=$(printf '%s' "${CONFIG_DATA}" | base64 -w0)"
+fi
+
+go run ./cmd delete-webhook -drop-pending-updates
 
 gcloud functions deploy "${WEBHOOK_FUNC_NAME}" \
   --runtime go116 \
   --trigger-http \
   --allow-unauthenticated \
   --entry-point=WebhookHandler \
-  --set-env-vars BOT_TOKEN="${BOT_TOKEN}",WEBHOOK_TOKEN="${WEBHOOK_TOKEN}",RUN_LOCAL=false \
+  --set-env-vars "${ENV_VARS}" \
   --memory=128MB \
   --region="${WEBHOOK_FUNC_REGION}" \
 ; echo
 
 URL=${URL:-$(gcloud functions describe --region="${WEBHOOK_FUNC_REGION}" "${WEBHOOK_FUNC_NAME}" --format="value(httpsTrigger.url)")}
 
-curl \
-  -X POST \
-  -F "url=${URL}/webhook/${WEBHOOK_TOKEN}" \
-  -F 'allowed_updates=["message", "inline_query"]' https://api.telegram.org/bot"${BOT_TOKEN}"/setWebhook \
-; echo
\ No newline at end of file
+go run ./cmd set-webhook -public-url "${URL}" -token "${WEBHOOK_TOKEN}"
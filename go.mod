@@ -3,8 +3,11 @@ module github.com/DzyubSpirit/reTGanslatorBot
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/GoogleCloudPlatform/functions-framework-go v1.5.3
 	github.com/go-telegram-bot-api/telegram-bot-api v4.6.4+incompatible
 	github.com/google/go-cmp v0.5.8
+	github.com/prometheus/client_golang v1.12.2
 	github.com/technoweenie/multipartstreamer v1.0.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
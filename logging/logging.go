@@ -0,0 +1,226 @@
+// Package logging writes leveled, structured log lines as JSON objects that
+// Google Cloud Logging understands. Every line carries the fields attached
+// with Logger.With, such as the ID of the update being handled.
+package logging
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String returns the Cloud Logging severity name of the level.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARNING"
+	case LevelError:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LEVEL(%d)", int(l))
+	}
+}
+
+// ParseLevel parses "debug", "info", "warn" or "error" in any letter case.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", s)
+	}
+}
+
+// sink is shared by a Logger and all loggers derived from it.
+type sink struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level Level
+	now   func() time.Time
+}
+
+type Logger struct {
+	sink   *sink
+	fields []interface{}
+}
+
+// New creates a Logger that writes lines of the given level and above to out.
+func New(out io.Writer, level Level) *Logger {
+	return &Logger{sink: &sink{out: out, level: level, now: time.Now}}
+}
+
+var defaultLogger = New(os.Stderr, LevelInfo)
+
+// Default returns the Logger writing to stderr at the info level.
+func Default() *Logger {
+	return defaultLogger
+}
+
+// SetLevel changes the level of l and of all loggers sharing its output.
+func (l *Logger) SetLevel(level Level) {
+	l.sink.mu.Lock()
+	l.sink.level = level
+	l.sink.mu.Unlock()
+}
+
+// Enabled reports whether lines of the given level are written.
+func (l *Logger) Enabled(level Level) bool {
+	l.sink.mu.Lock()
+	defer l.sink.mu.Unlock()
+	return level >= l.sink.level
+}
+
+// With returns a Logger that adds the key-value pairs to every line.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+	return &Logger{sink: l.sink, fields: fields}
+}
+
+func (l *Logger) Debug(msg string, keyvals ...interface{}) { l.log(LevelDebug, msg, keyvals) }
+func (l *Logger) Info(msg string, keyvals ...interface{})  { l.log(LevelInfo, msg, keyvals) }
+func (l *Logger) Warn(msg string, keyvals ...interface{})  { l.log(LevelWarn, msg, keyvals) }
+func (l *Logger) Error(msg string, keyvals ...interface{}) { l.log(LevelError, msg, keyvals) }
+
+// Fatal logs at the error level and exits the process.
+func (l *Logger) Fatal(msg string, keyvals ...interface{}) {
+	l.log(LevelError, msg, keyvals)
+	os.Exit(1)
+}
+
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	l.sink.mu.Lock()
+	defer l.sink.mu.Unlock()
+	if level < l.sink.level {
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"severity":`)
+	writeValue(&buf, level.String())
+	buf.WriteString(`,"time":`)
+	writeValue(&buf, l.sink.now().UTC().Format(time.RFC3339Nano))
+	buf.WriteString(`,"message":`)
+	writeValue(&buf, msg)
+	writeFields(&buf, l.fields)
+	writeFields(&buf, keyvals)
+	buf.WriteString("}\n")
+	l.sink.out.Write(buf.Bytes())
+}
+
+func writeFields(buf *bytes.Buffer, keyvals []interface{}) {
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		var value interface{} = "(MISSING)"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		buf.WriteByte(',')
+		writeValue(buf, key)
+		buf.WriteByte(':')
+		writeValue(buf, value)
+	}
+}
+
+func writeValue(buf *bytes.Buffer, value interface{}) {
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		raw, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(raw)
+}
+
+// Redact replaces a message body with its length and a short hash, so log
+// lines about the same text can still be matched without revealing it.
+func Redact(text string) string {
+	if text == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(text))
+	return fmt.Sprintf("[redacted len=%d sha256=%s]", len([]rune(text)), hex.EncodeToString(sum[:6]))
+}
+
+// RedactError strips the request URL from the error of an HTTP request,
+// keeping the cause and whatever wraps it. Bot API request URLs carry the bot
+// token, so their errors are logged through it. Other errors are returned as
+// they are.
+func RedactError(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	redacted := fmt.Sprintf("%s: %v", urlErr.Op, urlErr.Err)
+	if msg := err.Error(); strings.Contains(msg, urlErr.Error()) {
+		redacted = strings.Replace(msg, urlErr.Error(), redacted, 1)
+	}
+	return redactedError{msg: redacted, err: urlErr.Err}
+}
+
+// redactedError is an error with the request URL cut from its text.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e redactedError) Error() string { return e.msg }
+
+func (e redactedError) Unwrap() error { return e.err }
+
+// BotLogger adapts a Logger to tgbotapi.BotLogger. The library prints Bot API
+// payloads with Printf when its Debug mode is on, so those go to the debug
+// level, while its Println calls report polling problems.
+type BotLogger struct {
+	Logger *Logger
+	// Verbose reports whether payloads may be logged now. The Debug mode of
+	// the library can't be switched safely while it sends requests, so it's
+	// left on and the payloads are dropped here instead. Nil logs them all.
+	Verbose func() bool
+}
+
+func (b BotLogger) Println(v ...interface{}) {
+	for i, arg := range v {
+		if err, ok := arg.(error); ok {
+			v[i] = RedactError(err)
+		}
+	}
+	b.Logger.Info(strings.TrimSuffix(fmt.Sprintln(v...), "\n"), "component", "tgbotapi")
+}
+
+func (b BotLogger) Printf(format string, v ...interface{}) {
+	if b.Verbose != nil && !b.Verbose() {
+		return
+	}
+	b.Logger.Debug(strings.TrimSuffix(fmt.Sprintf(format, v...), "\n"), "component", "tgbotapi")
+}
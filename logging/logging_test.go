@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggerWritesStructuredLines(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(&out, LevelInfo)
+	logger.sink.now = func() time.Time { return time.Date(2022, 2, 24, 4, 0, 0, 0, time.UTC) }
+
+	updateLogger := logger.With("update_id", 42)
+	updateLogger.Debug("hidden")
+	updateLogger.Warn("send failed", "chat_id", int64(-100), "error", errors.New("Forbidden"))
+
+	want := `{"severity":"WARNING","time":"2022-02-24T04:00:00Z","message":"send failed","update_id":42,"chat_id":-100,"error":"Forbidden"}` + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("got log output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRedactHidesText(t *testing.T) {
+	text := "Зустріч о 18:00 *Asgard"
+	got := Redact(text)
+	if strings.Contains(got, "Asgard") || strings.Contains(got, "18:00") {
+		t.Errorf("Redact(%q) = %q leaks the text", text, got)
+	}
+	if got != Redact(text) {
+		t.Errorf("Redact isn't deterministic")
+	}
+	if Redact("") != "" {
+		t.Errorf("Redact of an empty text should stay empty")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for in, want := range map[string]Level{"debug": LevelDebug, "": LevelInfo, "WARN": LevelWarn, "error": LevelError} {
+		got, err := ParseLevel(in)
+		if err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v, nil", in, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Errorf("ParseLevel(loud) should fail")
+	}
+}
+
+func TestRedactErrorHidesRequestURL(t *testing.T) {
+	urlErr := &url.Error{Op: "Post", URL: "https://api.telegram.org/bot123456:SECRET-BOT-TOKEN/getMe", Err: errors.New("connection refused")}
+	cause := urlErr.Err
+
+	got := RedactError(fmt.Errorf("deleteWebhook: %w", urlErr))
+
+	if got.Error() != "deleteWebhook: Post: connection refused" {
+		t.Errorf("RedactError kept %q, want the request URL cut", got)
+	}
+	if !errors.Is(got, cause) {
+		t.Errorf("RedactError lost the cause of %q", got)
+	}
+	if err := errors.New("Forbidden"); RedactError(err) != err {
+		t.Errorf("RedactError changed an error without a request URL")
+	}
+
+	var out bytes.Buffer
+	BotLogger{Logger: New(&out, LevelInfo)}.Println(urlErr)
+	if strings.Contains(out.String(), "SECRET-BOT-TOKEN") {
+		t.Errorf("BotLogger logged the request URL: %s", out.String())
+	}
+}
+
+func TestBotLoggerLogsPayloadsWhileVerbose(t *testing.T) {
+	var out bytes.Buffer
+	verbose := true
+	b := BotLogger{Logger: New(&out, LevelDebug), Verbose: func() bool { return verbose }}
+
+	b.Printf("%s resp: %s", "sendMessage", "payload-1")
+	verbose = false
+	b.Printf("%s resp: %s", "sendMessage", "payload-2")
+	b.Println("Failed to get updates, retrying in 3 seconds...")
+
+	logs := out.String()
+	if !strings.Contains(logs, "payload-1") || strings.Contains(logs, "payload-2") {
+		t.Errorf("Expected payloads logged only while verbose, got:\n%s", logs)
+	}
+	if !strings.Contains(logs, "Failed to get updates") {
+		t.Errorf("Expected polling problems logged anyway, got:\n%s", logs)
+	}
+}
@@ -0,0 +1,97 @@
+// Package metrics exports the bot activity in the Prometheus format.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "retganslator"
+
+// Prometheus implements bot.Metrics on top of a Prometheus registry.
+type Prometheus struct {
+	registry *prometheus.Registry
+
+	updates    *prometheus.CounterVec
+	tags       *prometheus.CounterVec
+	deliveries *prometheus.CounterVec
+	sendErrors *prometheus.CounterVec
+	latency    *prometheus.HistogramVec
+}
+
+// NewPrometheus creates the bot metrics in a fresh registry that also carries
+// the standard Go runtime and process collectors.
+func NewPrometheus() *Prometheus {
+	p := &Prometheus{
+		registry: prometheus.NewRegistry(),
+		updates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "updates_total",
+			Help:      "Telegram updates received, by update type.",
+		}, []string{"type"}),
+		tags: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tags_matched_total",
+			Help:      "Tags found in messages from configured chats, by alias.",
+		}, []string{"alias"}),
+		deliveries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "deliveries_total",
+			Help:      "Messages forwarded, by source and destination chat.",
+		}, []string{"from_chat", "to_chat"}),
+		sendErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "send_errors_total",
+			Help:      "Failed Bot API calls, by Telegram error code.",
+		}, []string{"code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "update_handling_seconds",
+			Help:      "Time spent handling an update, by update type.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"type"}),
+	}
+	p.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		p.updates,
+		p.tags,
+		p.deliveries,
+		p.sendErrors,
+		p.latency,
+	)
+	return p
+}
+
+// Handler serves the collected metrics for scraping.
+func (p *Prometheus) Handler() http.Handler {
+	return promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{})
+}
+
+func (p *Prometheus) UpdateReceived(kind string) {
+	p.updates.WithLabelValues(kind).Inc()
+}
+
+func (p *Prometheus) TagMatched(alias string) {
+	p.tags.WithLabelValues(alias).Inc()
+}
+
+func (p *Prometheus) MessageDelivered(fromChatID, toChatID int64) {
+	p.deliveries.WithLabelValues(chatLabel(fromChatID), chatLabel(toChatID)).Inc()
+}
+
+func (p *Prometheus) SendFailed(code string) {
+	p.sendErrors.WithLabelValues(code).Inc()
+}
+
+func (p *Prometheus) UpdateHandled(kind string, duration time.Duration) {
+	p.latency.WithLabelValues(kind).Observe(duration.Seconds())
+}
+
+func chatLabel(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/bot"
+	"github.com/DzyubSpirit/reTGanslatorBot/configsource"
+	"github.com/DzyubSpirit/reTGanslatorBot/logging"
+	"github.com/DzyubSpirit/reTGanslatorBot/store"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// AppConfig is what setting the bot up takes, the same in every deployment.
+type AppConfig struct {
+	// ConfigSource is the config source, see configsource.Parse.
+	ConfigSource string
+	// LogLevel overrides the level of the config if set.
+	LogLevel string
+	// StorePath is the file the bot keeps its state in, memory if empty.
+	StorePath string
+	// BotToken authorizes the Bot API client.
+	BotToken string
+	// Options configure the Handler further, e.g. with metrics.
+	Options []bot.Option
+}
+
+// App is the Handler with what it runs on. The Cloud Function, the
+// self-hosted webhook and the polling bot are all set up as an App.
+type App struct {
+	Log     *logging.Logger
+	BotAPI  *tgbotapi.BotAPI
+	Handler *bot.Handler
+	Store   store.Store
+}
+
+// NewApp loads the config, sets up logging by it, opens the store and
+// authorizes on the Bot API. The warnings of the config are logged.
+func NewApp(c AppConfig) (*App, error) {
+	src, err := configsource.Parse(c.ConfigSource)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config source: %w", err)
+	}
+	data, err := src.Load()
+	if err != nil {
+		return nil, fmt.Errorf("load the config %s: %w", src, err)
+	}
+	config, problems := bot.ParseConfigAs(data, configsource.FormatOf(src))
+	for _, p := range problems.Warnings() {
+		logging.Default().Warn("Config problem", "source", src.String(), "problem", p.String())
+	}
+	if err := problems.Err(); err != nil {
+		return nil, fmt.Errorf("parse the config %s: %w", src, err)
+	}
+
+	log, err := config.Logging.NewLogger(c.LogLevel)
+	if err != nil {
+		return nil, fmt.Errorf("set up logging: %w", err)
+	}
+
+	var st store.Store = store.NewMemory()
+	if c.StorePath != "" {
+		if st, err = store.OpenFile(c.StorePath); err != nil {
+			return nil, fmt.Errorf("open the store: %w", err)
+		}
+	}
+
+	if c.BotToken == "" {
+		return nil, errors.New("BOT_TOKEN has to be specified")
+	}
+	botAPI, err := tgbotapi.NewBotAPI(c.BotToken)
+	if err != nil {
+		return nil, fmt.Errorf("initialize the Bot API: %w", logging.RedactError(err))
+	}
+
+	opts := append([]bot.Option{bot.WithLogger(log), bot.WithStore(st)}, c.Options...)
+	handler := bot.NewHandler(config, botAPI, opts...)
+
+	// The Bot API client dumps whole payloads in the debug mode, they're
+	// logged while the current config asks for them.
+	tgbotapi.SetLogger(logging.BotLogger{Logger: log, Verbose: func() bool {
+		return handler.Config().Logging.Verbose(time.Now())
+	}})
+	botAPI.Debug = true
+
+	log.Info("Authorized on account", "username", botAPI.Self.UserName)
+	return &App{Log: log, BotAPI: botAPI, Handler: handler, Store: st}, nil
+}
+
+// NewWebhook returns the webhook Server of the app receiving updates at the
+// path token, with metrics, readiness checks and, if debugToken is set, the
+// effective config. opts configure it further.
+func NewWebhook(a *App, token, debugToken string, metrics http.Handler, opts ...Option) *Server {
+	return New(a.Handler, token, append([]Option{
+		WithLogger(a.Log),
+		WithSecretToken(token),
+		WithMetricsHandler(metrics),
+		WithReadinessCheck("config", func() error { return ConfigLoaded(a.Handler.Config()) }),
+		WithReadinessCheck("bot_api", func() error { _, err := a.BotAPI.GetMe(); return err }),
+		WithReadinessCheck("store", a.Store.Ping),
+		WithDebugConfig(debugToken, a.Handler.Config),
+	}, opts...)...)
+}
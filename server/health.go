@@ -0,0 +1,165 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/bot"
+	"github.com/DzyubSpirit/reTGanslatorBot/logging"
+)
+
+type readinessCheck struct {
+	name  string
+	check func() error
+}
+
+// WithReadinessCheck makes /readyz fail while check returns an error.
+func WithReadinessCheck(name string, check func() error) Option {
+	return func(s *Server) {
+		s.checks = append(s.checks, readinessCheck{name: name, check: check})
+	}
+}
+
+// WithDebugConfig exposes the effective configuration on /debug/config to
+// requests with the "Authorization: Bearer <token>" header. The endpoint is
+// disabled when token is empty.
+func WithDebugConfig(token string, config func() bot.Config) Option {
+	return func(s *Server) {
+		s.debugToken = token
+		s.config = config
+	}
+}
+
+// WithProtectedOps makes /metrics and /readyz require the token of
+// WithDebugConfig too, and turns them off if it's empty. /metrics names the
+// chats and aliases, and every /readyz request calls the Bot API, so they
+// shouldn't be open where anyone can reach them, as in the Cloud Function.
+func WithProtectedOps() Option {
+	return func(s *Server) {
+		s.protectedOps = true
+	}
+}
+
+// ConfigLoaded is a readiness check that fails until some chats are configured.
+func ConfigLoaded(config bot.Config) error {
+	if len(config.AllChats()) == 0 {
+		return errors.New("no chats configured")
+	}
+	return nil
+}
+
+// healthzHandler reports that the process is alive and serving requests.
+func (s Server) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// readyzHandler runs all readiness checks and reports each of them. The
+// endpoint may be unauthenticated, so the errors are only logged: those of the
+// Bot API carry the token in the request URL.
+func (s Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	results := make(map[string]string, len(s.checks))
+	code := http.StatusOK
+	for _, c := range s.checks {
+		if err := c.check(); err != nil {
+			s.logger.Warn("Readiness check failed", "check", c.name, "error", logging.RedactError(err))
+			results[c.name] = "failed"
+			code = http.StatusServiceUnavailable
+			continue
+		}
+		results[c.name] = "ok"
+	}
+	s.writeJSON(w, code, results)
+}
+
+type debugConfig struct {
+	Config     interface{}        `json:"config"`
+	AliasIndex map[string][]int64 `json:"alias_index"`
+}
+
+// requireDebugToken passes only the requests with the
+// "Authorization: Bearer <token>" header of the debug token on to h.
+func (s Server) requireDebugToken(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.debugToken)) != 1 {
+			httpErr(w, http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s Server) debugConfigHandler(w http.ResponseWriter, r *http.Request) {
+	config := s.config()
+	// Round-trip through JSON to get a generic tree the secrets can be cut from.
+	raw, err := json.Marshal(config)
+	if err != nil {
+		s.logger.Error("Failed to marshal config", "error", err)
+		httpErr(w, http.StatusInternalServerError)
+		return
+	}
+	var tree interface{}
+	if err := json.Unmarshal(raw, &tree); err != nil {
+		s.logger.Error("Failed to unmarshal config", "error", err)
+		httpErr(w, http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, debugConfig{
+		Config:     redactSecrets(tree),
+		AliasIndex: aliasIndex(bot.NewIndex(config)),
+	})
+}
+
+// aliasIndex maps every lowercased alias and group name to the IDs of the
+// chats it reaches, as the bot routes them.
+func aliasIndex(ix *bot.Index) map[string][]int64 {
+	index := make(map[string][]int64)
+	for _, alias := range ix.Aliases() {
+		index[strings.ToLower(alias)] = ix.AliasChatIDs(alias)
+	}
+	return index
+}
+
+// secretKeyParts are substrings of JSON keys whose values never leave the bot.
+var secretKeyParts = []string{"token", "secret", "password", "hash", "key"}
+
+func redactSecrets(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if isSecretKey(key) {
+				v[key] = "[redacted]"
+				continue
+			}
+			v[key] = redactSecrets(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactSecrets(value)
+		}
+	}
+	return v
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range secretKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Server) writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Warn("Failed to write the response", "error", err)
+	}
+}
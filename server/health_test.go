@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/bot"
+	"github.com/DzyubSpirit/reTGanslatorBot/logging"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestServer_healthz(t *testing.T) {
+	srv := New(&fakeUpdater{}, "12345")
+
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected error code 200, got=%d", rr.Code)
+	}
+}
+
+func TestServer_readyz(t *testing.T) {
+	for _, testCase := range []struct {
+		name        string
+		storeErr    error
+		wantCode    int
+		wantResults map[string]string
+	}{
+		{name: "all checks pass",
+			wantCode:    http.StatusOK,
+			wantResults: map[string]string{"config": "ok", "store": "ok"}},
+		{name: "a failing check makes the server unready",
+			storeErr:    errors.New("read-only file system"),
+			wantCode:    http.StatusServiceUnavailable,
+			wantResults: map[string]string{"config": "ok", "store": "failed"}},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			srv := New(&fakeUpdater{}, "12345",
+				WithReadinessCheck("config", func() error { return nil }),
+				WithReadinessCheck("store", func() error { return testCase.storeErr }),
+			)
+
+			rr := httptest.NewRecorder()
+			srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if rr.Code != testCase.wantCode {
+				t.Errorf("expected error code %d, got=%d", testCase.wantCode, rr.Code)
+			}
+			var results map[string]string
+			if err := json.Unmarshal(rr.Body.Bytes(), &results); err != nil {
+				t.Fatalf("unexpected error during unmarshaling readiness results: %v", err)
+			}
+			if diff := cmp.Diff(testCase.wantResults, results); diff != "" {
+				t.Errorf("wrong readiness results, cmp.Diff(want, got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestServer_debugConfig(t *testing.T) {
+	config := bot.Config{
+		Chats:        []bot.Chat{{ID: 1, Aliases: bot.NewAliases("First", "All")}, {ID: 2, Aliases: bot.NewAliases("All")}},
+		HelpContacts: []string{"@Karas"},
+	}
+	srv := New(&fakeUpdater{}, "12345", WithDebugConfig("debug-secret", func() bot.Config { return config }))
+
+	for _, testCase := range []struct {
+		name     string
+		auth     string
+		wantCode int
+	}{
+		{name: "no token", auth: "", wantCode: http.StatusUnauthorized},
+		{name: "wrong token", auth: "Bearer 12345", wantCode: http.StatusUnauthorized},
+		{name: "right token", auth: "Bearer debug-secret", wantCode: http.StatusOK},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/debug/config", nil)
+			if testCase.auth != "" {
+				req.Header.Set("Authorization", testCase.auth)
+			}
+			rr := httptest.NewRecorder()
+			srv.ServeHTTP(rr, req)
+
+			if rr.Code != testCase.wantCode {
+				t.Fatalf("expected error code %d, got=%d", testCase.wantCode, rr.Code)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+			if body := rr.Body.String(); !strings.Contains(body, `"all":[1,2]`) {
+				t.Errorf("expected the alias index in the response, got=%s", body)
+			}
+		})
+	}
+}
+
+func TestServer_debugConfigIndexesLikeTheRouter(t *testing.T) {
+	config := bot.Config{
+		Chats:  []bot.Chat{{ID: 1, Aliases: bot.NewAliases("All")}, {ID: 2, Aliases: bot.NewAliases("Second")}},
+		Groups: []bot.Group{{Name: "All", Chats: []int64{2}}},
+	}
+	srv := New(&fakeUpdater{}, "12345", WithDebugConfig("debug-secret", func() bot.Config { return config }))
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/config", nil)
+	req.Header.Set("Authorization", "Bearer debug-secret")
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+
+	// A group named like an alias adds its chats to the alias.
+	if body := rr.Body.String(); !strings.Contains(body, `"all":[1,2]`) {
+		t.Errorf("expected the alias index of the router in the response, got=%s", body)
+	}
+}
+
+func TestServer_debugConfigDisabledWithoutToken(t *testing.T) {
+	srv := New(&fakeUpdater{}, "12345", WithDebugConfig("", func() bot.Config { return bot.Config{} }))
+
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected error code 404, got=%d", rr.Code)
+	}
+}
+
+func TestServer_protectedOps(t *testing.T) {
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("retganslator_updates_total 1\n"))
+	})
+	config := func() bot.Config { return bot.Config{} }
+
+	for _, testCase := range []struct {
+		name       string
+		debugToken string
+		auth       string
+		wantCode   int
+	}{
+		{name: "no token", debugToken: "debug-secret", wantCode: http.StatusUnauthorized},
+		{name: "wrong token", debugToken: "debug-secret", auth: "Bearer 12345", wantCode: http.StatusUnauthorized},
+		{name: "right token", debugToken: "debug-secret", auth: "Bearer debug-secret", wantCode: http.StatusOK},
+		{name: "no debug token configured", auth: "Bearer ", wantCode: http.StatusNotFound},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			srv := New(&fakeUpdater{}, "12345", WithMetricsHandler(metrics),
+				WithReadinessCheck("config", func() error { return nil }),
+				WithDebugConfig(testCase.debugToken, config), WithProtectedOps())
+
+			for _, path := range []string{"/metrics", "/readyz"} {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				if testCase.auth != "" {
+					req.Header.Set("Authorization", testCase.auth)
+				}
+				rr := httptest.NewRecorder()
+				srv.ServeHTTP(rr, req)
+
+				if rr.Code != testCase.wantCode {
+					t.Errorf("expected error code %d for %s, got=%d", testCase.wantCode, path, rr.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	tree := map[string]interface{}{
+		"chats": []interface{}{map[string]interface{}{"id": 1.0}},
+		"source": map[string]interface{}{
+			"url":          "https://example.com/config.json",
+			"bearer_token": "abc",
+		},
+	}
+
+	got := redactSecrets(tree)
+
+	want := map[string]interface{}{
+		"chats": []interface{}{map[string]interface{}{"id": 1.0}},
+		"source": map[string]interface{}{
+			"url":          "https://example.com/config.json",
+			"bearer_token": "[redacted]",
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("redactSecrets returned wrong tree, cmp.Diff(want, got): %s", diff)
+	}
+}
+
+func TestServer_readyzHidesErrors(t *testing.T) {
+	var logs bytes.Buffer
+	apiErr := &url.Error{Op: "Post", URL: "https://api.telegram.org/bot123456:SECRET-BOT-TOKEN/getMe", Err: errors.New("connection refused")}
+	srv := New(&fakeUpdater{}, "12345",
+		WithLogger(logging.New(&logs, logging.LevelInfo)),
+		WithReadinessCheck("bot_api", func() error { return apiErr }),
+	)
+
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if body := rr.Body.String(); strings.Contains(body, "SECRET-BOT-TOKEN") || !strings.Contains(body, `"bot_api":"failed"`) {
+		t.Errorf("expected the check to fail without the error, got=%s", body)
+	}
+	if strings.Contains(logs.String(), "SECRET-BOT-TOKEN") || !strings.Contains(logs.String(), "connection refused") {
+		t.Errorf("expected the cause logged without the token, got=%s", logs.String())
+	}
+}
@@ -0,0 +1,160 @@
+// Package server receives Telegram updates over HTTP and serves the operational
+// endpoints of the bot. It runs both as the Google Cloud Function and as the
+// self-hosted webhook of the cmd binary.
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	urlpath "path"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/bot"
+	"github.com/DzyubSpirit/reTGanslatorBot/logging"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// secretTokenHeader carries the secret_token passed to setWebhook.
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+type updater interface {
+	HandleUpdate(tgbotapi.Update) error
+}
+
+type Server struct {
+	token       string
+	secretToken string
+	updater     updater
+	logger      *logging.Logger
+	metrics     http.Handler
+	checks      []readinessCheck
+	debugToken  string
+	// protectedOps puts /metrics and /readyz behind debugToken.
+	protectedOps bool
+	config       func() bot.Config
+	handler      http.Handler
+}
+
+// Option configures optional Server endpoints.
+type Option func(*Server)
+
+// WithLogger makes the Server write its logs to logger.
+func WithLogger(logger *logging.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithMetricsHandler exposes metrics on /metrics.
+func WithMetricsHandler(h http.Handler) Option {
+	return func(s *Server) {
+		s.metrics = h
+	}
+}
+
+// WithSecretToken makes the Server accept only updates that carry the
+// secret_token the webhook was registered with.
+func WithSecretToken(secretToken string) Option {
+	return func(s *Server) {
+		s.secretToken = secretToken
+	}
+}
+
+func New(updater updater, token string, opts ...Option) *Server {
+	s := Server{
+		updater: updater,
+		token:   token,
+		logger:  logging.Default(),
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	s.handler = s.buildHandler()
+	return &s
+}
+
+func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+func (s Server) buildHandler() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(WebhookPath(s.token), s.updateHandler)
+	mux.HandleFunc("/healthz", s.healthzHandler)
+	switch {
+	case !s.protectedOps:
+		mux.HandleFunc("/readyz", s.readyzHandler)
+		if s.metrics != nil {
+			mux.Handle("/metrics", s.metrics)
+		}
+	case s.debugToken != "":
+		mux.Handle("/readyz", s.requireDebugToken(http.HandlerFunc(s.readyzHandler)))
+		if s.metrics != nil {
+			mux.Handle("/metrics", s.requireDebugToken(s.metrics))
+		}
+	}
+	if s.debugToken != "" && s.config != nil {
+		mux.Handle("/debug/config", s.requireDebugToken(http.HandlerFunc(s.debugConfigHandler)))
+	}
+
+	return mux
+}
+
+// WebhookPath is the path the Server receives updates on.
+func WebhookPath(token string) string {
+	return "/webhook/" + token
+}
+
+func (s Server) updateHandler(w http.ResponseWriter, r *http.Request) {
+	log := s.logger
+	if trace := r.Header.Get("X-Cloud-Trace-Context"); trace != "" {
+		log = log.With("trace", trace)
+	}
+
+	if r.Method != http.MethodPost {
+		log.Warn("Unknown HTTP method", "method", r.Method)
+		httpErr(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	if token := urlpath.Base(r.URL.Path); token != s.token {
+		// The token is a secret, so only its length gets logged.
+		log.Warn("Wrong webhook token", "token_length", len(token))
+		httpErr(w, http.StatusNotFound)
+		return
+	}
+
+	if s.secretToken != "" {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(secretTokenHeader)), []byte(s.secretToken)) != 1 {
+			log.Warn("Wrong webhook secret token header")
+			httpErr(w, http.StatusUnauthorized)
+			return
+		}
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Error("Failed to read the incoming payload", "error", err)
+		httpErr(w, http.StatusInternalServerError)
+		return
+	}
+	defer r.Body.Close()
+
+	var update tgbotapi.Update
+	if err := json.Unmarshal(data, &update); err != nil {
+		log.Warn("Failed to unmarshal incoming update", "error", err)
+		httpErr(w, http.StatusBadRequest)
+		return
+	}
+
+	if err := s.updater.HandleUpdate(update); err != nil {
+		log.Error("Handle incoming update", "update_id", update.UpdateID, "error", err)
+		httpErr(w, http.StatusInternalServerError)
+	}
+}
+
+func httpErr(w http.ResponseWriter, code int) {
+	http.Error(w, http.StatusText(code), code)
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+type fakeUpdater struct {
+	updates []tgbotapi.Update
+}
+
+func (f *fakeUpdater) HandleUpdate(update tgbotapi.Update) error {
+	f.updates = append(f.updates, update)
+	return nil
+}
+
+func TestServer_updateHandler_happy_path(t *testing.T) {
+	fu := &fakeUpdater{}
+
+	srv := New(fu, "12345")
+
+	u := tgbotapi.Update{
+		UpdateID: 1,
+		Message: &tgbotapi.Message{
+			MessageID: 123,
+		},
+	}
+
+	payload, err := json.Marshal(u)
+	if err != nil {
+		t.Fatalf("unexpected error during marshaling update payload: %v\n", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/12345", bytes.NewReader(payload))
+	req.Header.Add("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected error code 200, got=%d", rr.Code)
+	}
+
+	if got := rr.Body.String(); got != "" {
+		t.Errorf("expected empty response body, got=%v", got)
+	}
+
+	if len(fu.updates) != 1 {
+		t.Errorf("expected updates number = %d, got %d", 1, len(fu.updates))
+	}
+}
+
+func TestServer_metrics(t *testing.T) {
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("retganslator_updates_total 1\n"))
+	})
+	srv := New(&fakeUpdater{}, "12345", WithMetricsHandler(metrics))
+
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected error code 200, got=%d", rr.Code)
+	}
+	if got, want := rr.Body.String(), "retganslator_updates_total 1\n"; got != want {
+		t.Errorf("expected metrics body %q, got=%q", want, got)
+	}
+}
+
+func TestServer_updateHandler_secret_token(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		header   string
+		wantCode int
+	}{
+		{name: "missing header", header: "", wantCode: http.StatusUnauthorized},
+		{name: "wrong header", header: "nope", wantCode: http.StatusUnauthorized},
+		{name: "right header", header: "s3cret", wantCode: http.StatusOK},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			fu := &fakeUpdater{}
+			srv := New(fu, "12345", WithSecretToken("s3cret"))
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook/12345", bytes.NewReader([]byte(`{"update_id":1}`)))
+			if testCase.header != "" {
+				req.Header.Set(secretTokenHeader, testCase.header)
+			}
+			rr := httptest.NewRecorder()
+			srv.ServeHTTP(rr, req)
+
+			if rr.Code != testCase.wantCode {
+				t.Errorf("expected error code %d, got=%d", testCase.wantCode, rr.Code)
+			}
+		})
+	}
+}
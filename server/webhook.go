@@ -0,0 +1,84 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/DzyubSpirit/reTGanslatorBot/bot"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Requester makes raw Bot API requests. tgbotapi.BotAPI implements it.
+type Requester interface {
+	MakeRequest(endpoint string, params url.Values) (tgbotapi.APIResponse, error)
+	UploadFile(endpoint string, params map[string]string, fieldname string, file interface{}) (tgbotapi.APIResponse, error)
+}
+
+// Webhook describes how Telegram delivers updates to a Server.
+type Webhook struct {
+	// BaseURL is where the Server is reachable from the internet, e.g.
+	// "https://bot.example.com".
+	BaseURL string
+	// Token is the secret part of the webhook path. It's also sent back by
+	// Telegram in the X-Telegram-Bot-Api-Secret-Token header.
+	Token string
+	// Certificate is the path to a self-signed certificate to upload.
+	Certificate string
+	// MaxConnections limits simultaneous update deliveries, 40 by default.
+	MaxConnections int
+	// DropPendingUpdates discards updates that arrived before registration.
+	DropPendingUpdates bool
+}
+
+// URL is the full URL Telegram posts updates to.
+func (wh Webhook) URL() string {
+	return strings.TrimSuffix(wh.BaseURL, "/") + WebhookPath(wh.Token)
+}
+
+// SetWebhook registers the webhook for the update types the bot handles.
+func SetWebhook(api Requester, wh Webhook) error {
+	params := map[string]string{
+		"url":             wh.URL(),
+		"allowed_updates": allowedUpdatesParam(),
+		"secret_token":    wh.Token,
+	}
+	if wh.MaxConnections != 0 {
+		params["max_connections"] = strconv.Itoa(wh.MaxConnections)
+	}
+	if wh.DropPendingUpdates {
+		params["drop_pending_updates"] = "true"
+	}
+
+	var err error
+	if wh.Certificate != "" {
+		_, err = api.UploadFile("setWebhook", params, "certificate", wh.Certificate)
+	} else {
+		values := url.Values{}
+		for key, value := range params {
+			values.Set(key, value)
+		}
+		_, err = api.MakeRequest("setWebhook", values)
+	}
+	if err != nil {
+		return fmt.Errorf("setWebhook: %w", err)
+	}
+	return nil
+}
+
+// DeleteWebhook unregisters the webhook so updates can be polled again.
+func DeleteWebhook(api Requester, dropPendingUpdates bool) error {
+	values := url.Values{}
+	if dropPendingUpdates {
+		values.Set("drop_pending_updates", "true")
+	}
+	if _, err := api.MakeRequest("deleteWebhook", values); err != nil {
+		return fmt.Errorf("deleteWebhook: %w", err)
+	}
+	return nil
+}
+
+func allowedUpdatesParam() string {
+	return `["` + strings.Join(bot.AllowedUpdates, `","`) + `"]`
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/url"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/google/go-cmp/cmp"
+)
+
+type fakeRequester struct {
+	endpoint string
+	params   url.Values
+	upload   map[string]string
+	file     interface{}
+}
+
+func (f *fakeRequester) MakeRequest(endpoint string, params url.Values) (tgbotapi.APIResponse, error) {
+	f.endpoint, f.params = endpoint, params
+	return tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func (f *fakeRequester) UploadFile(endpoint string, params map[string]string, fieldname string, file interface{}) (tgbotapi.APIResponse, error) {
+	f.endpoint, f.upload, f.file = endpoint, params, file
+	return tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func TestSetWebhook(t *testing.T) {
+	api := &fakeRequester{}
+
+	err := SetWebhook(api, Webhook{BaseURL: "https://bot.example.com/", Token: "abc123", DropPendingUpdates: true})
+	if err != nil {
+		t.Fatalf("SetWebhook failed: %v", err)
+	}
+
+	want := url.Values{
+		"url":                  {"https://bot.example.com/webhook/abc123"},
+		"allowed_updates":      {`["message","inline_query","chosen_inline_result","callback_query"]`},
+		"secret_token":         {"abc123"},
+		"drop_pending_updates": {"true"},
+	}
+	if api.endpoint != "setWebhook" {
+		t.Errorf("expected a setWebhook request, got=%s", api.endpoint)
+	}
+	if diff := cmp.Diff(want, api.params); diff != "" {
+		t.Errorf("wrong setWebhook params, cmp.Diff(want, got): %s", diff)
+	}
+}
+
+func TestSetWebhook_selfSigned(t *testing.T) {
+	api := &fakeRequester{}
+
+	if err := SetWebhook(api, Webhook{BaseURL: "https://10.0.0.1:8443", Token: "abc123", Certificate: "cert.pem"}); err != nil {
+		t.Fatalf("SetWebhook failed: %v", err)
+	}
+
+	if api.file != "cert.pem" {
+		t.Errorf("expected the certificate to be uploaded, got=%v", api.file)
+	}
+	if got := api.upload["url"]; got != "https://10.0.0.1:8443/webhook/abc123" {
+		t.Errorf("wrong webhook url, got=%s", got)
+	}
+}
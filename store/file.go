@@ -0,0 +1,121 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// File is a Store persisted as a single JSON object on disk. Every change
+// rewrites the whole file, so it suits the small amounts of state the bot keeps.
+type File struct {
+	path string
+
+	mu   sync.RWMutex
+	data map[string]json.RawMessage
+}
+
+// OpenFile loads the store from path. A missing file is an empty store.
+func OpenFile(path string) (*File, error) {
+	f := &File{
+		path: path,
+		data: make(map[string]json.RawMessage),
+	}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read store %s: %w", path, err)
+	}
+	if len(content) == 0 {
+		return f, nil
+	}
+	if err := json.Unmarshal(content, &f.data); err != nil {
+		return nil, fmt.Errorf("parse store %s: %w", path, err)
+	}
+	return f, nil
+}
+
+func (f *File) Get(key string, value interface{}) (bool, error) {
+	f.mu.RLock()
+	raw, ok := f.data[key]
+	f.mu.RUnlock()
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, value)
+}
+
+func (f *File) Put(key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prev, existed := f.data[key]
+	f.data[key] = raw
+	if err := f.flush(); err != nil {
+		if existed {
+			f.data[key] = prev
+		} else {
+			delete(f.data, key)
+		}
+		return err
+	}
+	return nil
+}
+
+func (f *File) Delete(key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	prev, existed := f.data[key]
+	if !existed {
+		return nil
+	}
+	delete(f.data, key)
+	if err := f.flush(); err != nil {
+		f.data[key] = prev
+		return err
+	}
+	return nil
+}
+
+// Ping creates and removes a temporary file next to the store.
+func (f *File) Ping() error {
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), ".ping-*")
+	if err != nil {
+		return fmt.Errorf("store %s isn't writable: %w", f.path, err)
+	}
+	tmp.Close()
+	return os.Remove(tmp.Name())
+}
+
+// flush atomically replaces the file with the current content. f.mu has to be
+// held for writing.
+func (f *File) flush() error {
+	content, err := json.Marshal(f.data)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return fmt.Errorf("write store %s: %w", f.path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write store %s: %w", f.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write store %s: %w", f.path, err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("write store %s: %w", f.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFileKeepsValuesAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	f, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile(%q) failed: %v", path, err)
+	}
+	if err := f.Put("recent", []string{"Asgard", "Midgard"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := f.Put("gone", 1); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := f.Delete("gone"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := f.Ping(); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+
+	reopened, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile(%q) failed on reopen: %v", path, err)
+	}
+	var recent []string
+	if ok, err := reopened.Get("recent", &recent); !ok || err != nil {
+		t.Fatalf("Get(recent) = %v, %v; want true, nil", ok, err)
+	}
+	if len(recent) != 2 || recent[0] != "Asgard" || recent[1] != "Midgard" {
+		t.Errorf("Get(recent) decoded %v, want [Asgard Midgard]", recent)
+	}
+	var gone int
+	if ok, _ := reopened.Get("gone", &gone); ok {
+		t.Errorf("Get(gone) found a deleted key")
+	}
+}
@@ -0,0 +1,64 @@
+// Package store keeps small pieces of bot state, such as caches and usage
+// statistics, as JSON values under string keys.
+package store
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Store is a key-value storage for JSON-serialisable values. Implementations
+// have to be safe for concurrent use.
+type Store interface {
+	// Get decodes the value stored under key into value. It reports false
+	// if there's no such key.
+	Get(key string, value interface{}) (bool, error)
+	// Put stores value under key, replacing the previous one.
+	Put(key string, value interface{}) error
+	// Delete removes key. Deleting a missing key isn't an error.
+	Delete(key string) error
+	// Ping checks that the store is able to persist new values.
+	Ping() error
+}
+
+// Memory is a Store that lives only as long as the process.
+type Memory struct {
+	mu   sync.RWMutex
+	data map[string]json.RawMessage
+}
+
+func NewMemory() *Memory {
+	return &Memory{data: make(map[string]json.RawMessage)}
+}
+
+func (m *Memory) Get(key string, value interface{}) (bool, error) {
+	m.mu.RLock()
+	raw, ok := m.data[key]
+	m.mu.RUnlock()
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, value)
+}
+
+func (m *Memory) Put(key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.data[key] = raw
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Memory) Delete(key string) error {
+	m.mu.Lock()
+	delete(m.data, key)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Memory) Ping() error {
+	return nil
+}